@@ -14,12 +14,17 @@ func AppCommand() *cobra.Command {
 	}
 	command.AddCommand(PreviewAppCommand())
 	command.AddCommand(PreviewAppResourcesCommand())
+	command.AddCommand(DiffAppCommand())
+	command.AddCommand(ValidateAppCommand())
+	command.AddCommand(CheckAPIsAppCommand())
+	command.AddCommand(CheckPoliciesAppCommand())
 	return command
 }
 
 func PreviewAppCommand() *cobra.Command {
-	var name string
+	var appFilterOpts appFilterOptions
 	var output string
+	var outputFile string
 	command := &cobra.Command{
 		Use:   "preview APPMANIFEST",
 		Short: "Preview Application spec",
@@ -29,17 +34,25 @@ func PreviewAppCommand() *cobra.Command {
 				os.Exit(1)
 			}
 			filename := args[0]
-			preview.PreviewApplication(filename, name, output)
+			w, closeOutput := openOutput(c, outputFile)
+			defer closeOutput()
+			preview.PreviewApplication(w, filename, appFilterOpts.filter(), output)
 		},
 	}
-	command.Flags().StringVarP(&name, "name", "n", "", "Name of the Application to preview")
-	command.Flags().StringVarP(&output, "output", "o", "name", "Output format. One of: name|json|yaml")
+	appFilterOpts.addFlags(command, "preview")
+	command.Flags().StringVarP(&output, "output", "o", "name",
+		"Output format. One of: name|json|yaml|jsonpath=...|go-template=...|custom-columns=...")
+	command.Flags().StringVar(&outputFile, "output-file", "", "Write the output to this file instead of stdout")
 	return command
 }
 
 func PreviewAppResourcesCommand() *cobra.Command {
-	var kind string
+	var filterOpts filterOptions
 	var output string
+	var order string
+	var outputFile string
+	var failOnDuplicates bool
+	var renderOpts renderOptions
 	command := &cobra.Command{
 		Use:   "preview-resources APPMANIFEST",
 		Short: "Preview Kubernetes resource(s) generated from an Application",
@@ -49,10 +62,165 @@ func PreviewAppResourcesCommand() *cobra.Command {
 				os.Exit(1)
 			}
 			filename := args[0]
-			preview.PreviewApplicationResources(filename, kind, output)
+			ctx, cancel := commandContext(c)
+			w, closeOutput := openOutput(c, outputFile)
+			duplicates := preview.PreviewApplicationResources(ctx, w, renderOpts.options(), filename,
+				filterOpts.filter(), preview.ResourceOrder(order), output)
+			closeOutput()
+			cancel()
+			if failOnDuplicates && len(duplicates) > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+	filterOpts.addFlags(command, "preview")
+	command.Flags().StringVar(&order, "sort", "kind",
+		"Order of the resources. One of: kind (grouped by kind)|sync (Argo CD sync order)|name")
+	command.Flags().StringVarP(&output, "output", "o", "name",
+		"Output format. One of: name|json|yaml|table|wide|plan|jsonpath=...|go-template=...|custom-columns=...|dir=PATH")
+	command.Flags().StringVar(&outputFile, "output-file", "", "Write the output to this file instead of stdout")
+	command.Flags().BoolVar(&failOnDuplicates, "fail-on-duplicates", false,
+		"Exit with a non-zero status when resources are rendered more than once")
+	renderOpts.addFlags(command)
+	return command
+}
+
+func DiffAppCommand() *cobra.Command {
+	var filterOpts filterOptions
+	var diffOpts diffOptions
+	var outputFile string
+	var failOnDuplicates bool
+	var renderOpts renderOptions
+	command := &cobra.Command{
+		Use:   "diff APPMANIFEST",
+		Short: "Diff Kubernetes resource(s) generated from an Application between two Git revisions or with a live state",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			ctx, cancel := commandContext(c)
+			w, closeOutput := openOutput(c, outputFile)
+			var duplicates []preview.DuplicateResource
+			if diffOpts.live != "" {
+				duplicates = preview.PreviewApplicationLiveDiff(ctx, w, renderOpts.options(), filename, diffOpts.live,
+					filterOpts.filter(), diffOpts.output, diffOpts.maxDiffLines)
+			} else {
+				duplicates = preview.PreviewApplicationDiff(ctx, w, renderOpts.options(), filename, diffOpts.base,
+					diffOpts.head, filterOpts.filter(), diffOpts.output, diffOpts.maxDiffLines)
+			}
+			closeOutput()
+			cancel()
+			if failOnDuplicates && len(duplicates) > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+	filterOpts.addFlags(command, "diff")
+	diffOpts.addFlags(command)
+	command.Flags().StringVar(&outputFile, "output-file", "", "Write the output to this file instead of stdout")
+	command.Flags().BoolVar(&failOnDuplicates, "fail-on-duplicates", false,
+		"Exit with a non-zero status when resources are rendered more than once")
+	renderOpts.addFlags(command)
+	return command
+}
+
+func ValidateAppCommand() *cobra.Command {
+	var filterOpts filterOptions
+	var schemaOpts schemaOptions
+	var outputFile string
+	var renderOpts renderOptions
+	command := &cobra.Command{
+		Use:   "validate APPMANIFEST",
+		Short: "Validate Kubernetes resource(s) generated from an Application against their OpenAPI schemas",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			ctx, cancel := commandContext(c)
+			w, closeOutput := openOutput(c, outputFile)
+			valid := preview.ValidateApplicationResources(ctx, w, renderOpts.options(), schemaOpts.options(), filename,
+				filterOpts.filter())
+			closeOutput()
+			cancel()
+			if !valid {
+				os.Exit(1)
+			}
+		},
+	}
+	filterOpts.addFlags(command, "validate")
+	schemaOpts.addFlags(command)
+	command.Flags().StringVar(&outputFile, "output-file", "", "Write the output to this file instead of stdout")
+	renderOpts.addFlags(command)
+	return command
+}
+
+func CheckAPIsAppCommand() *cobra.Command {
+	var filterOpts filterOptions
+	var targetVersion string
+	var outputFile string
+	var renderOpts renderOptions
+	command := &cobra.Command{
+		Use:   "check-apis APPMANIFEST",
+		Short: "Detect Kubernetes resource(s) generated from an Application using deprecated or removed API versions",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			ctx, cancel := commandContext(c)
+			w, closeOutput := openOutput(c, outputFile)
+			supported := preview.CheckApplicationAPIs(ctx, w, renderOpts.options(), targetVersion, filename,
+				filterOpts.filter())
+			closeOutput()
+			cancel()
+			if !supported {
+				os.Exit(1)
+			}
+		},
+	}
+	filterOpts.addFlags(command, "check")
+	command.Flags().StringVar(&targetVersion, "target-version", "",
+		"Kubernetes version to check the API versions against (e.g. 1.25). "+
+			"Defaults to the Kubernetes version of the destination cluster given with --kube-version")
+	command.Flags().StringVar(&outputFile, "output-file", "", "Write the output to this file instead of stdout")
+	renderOpts.addFlags(command)
+	return command
+}
+
+func CheckPoliciesAppCommand() *cobra.Command {
+	var filterOpts filterOptions
+	var policyOpts policyOptions
+	var outputFile string
+	var renderOpts renderOptions
+	command := &cobra.Command{
+		Use:   "check-policies APPMANIFEST",
+		Short: "Check Kubernetes resource(s) generated from an Application against policy rules and admission policies",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			policies := policyOpts.options()
+			ctx, cancel := commandContext(c)
+			w, closeOutput := openOutput(c, outputFile)
+			compliant := preview.CheckApplicationPolicies(ctx, w, renderOpts.options(), policies, filename,
+				filterOpts.filter())
+			closeOutput()
+			cancel()
+			if !compliant {
+				os.Exit(1)
+			}
 		},
 	}
-	command.Flags().StringVarP(&kind, "kind", "k", "", "Kind of resources to preview")
-	command.Flags().StringVarP(&output, "output", "o", "name", "Output format. One of: name|json|yaml")
+	filterOpts.addFlags(command, "check")
+	policyOpts.addFlags(command)
+	command.Flags().StringVar(&outputFile, "output-file", "", "Write the output to this file instead of stdout")
+	renderOpts.addFlags(command)
 	return command
 }
@@ -14,12 +14,17 @@ func AppSetCommand() *cobra.Command {
 	}
 	command.AddCommand(PreviewApplicationsCommand())
 	command.AddCommand(PreviewAppSetResourcesCommand())
+	command.AddCommand(DiffAppSetCommand())
+	command.AddCommand(ValidateAppSetCommand())
+	command.AddCommand(CheckAPIsAppSetCommand())
+	command.AddCommand(CheckPoliciesAppSetCommand())
 	return command
 }
 
 func PreviewApplicationsCommand() *cobra.Command {
-	var name string
+	var appFilterOpts appFilterOptions
 	var output string
+	var outputFile string
 	command := &cobra.Command{
 		Use:   "preview-apps APPSETMANIFEST",
 		Short: "Preview Application(s) generated from an ApplicationSet",
@@ -29,18 +34,28 @@ func PreviewApplicationsCommand() *cobra.Command {
 				os.Exit(1)
 			}
 			filename := args[0]
-			preview.PreviewApplications(filename, name, output)
+			ctx, cancel := commandContext(c)
+			defer cancel()
+			w, closeOutput := openOutput(c, outputFile)
+			defer closeOutput()
+			preview.PreviewApplications(ctx, w, filename, appFilterOpts.filter(), output)
 		},
 	}
-	command.Flags().StringVarP(&name, "name", "n", "", "Name of the Application to preview")
-	command.Flags().StringVarP(&output, "output", "o", "name", "Output format. One of: name|json|yaml")
+	appFilterOpts.addFlags(command, "preview")
+	command.Flags().StringVarP(&output, "output", "o", "name",
+		"Output format. One of: name|json|yaml|jsonpath=...|go-template=...|custom-columns=...")
+	command.Flags().StringVar(&outputFile, "output-file", "", "Write the output to this file instead of stdout")
 	return command
 }
 
 func PreviewAppSetResourcesCommand() *cobra.Command {
-	var kind string
-	var name string
+	var filterOpts filterOptions
+	var appFilterOpts appFilterOptions
 	var output string
+	var order string
+	var outputFile string
+	var failOnDuplicates bool
+	var renderOpts renderOptions
 	command := &cobra.Command{
 		Use:   "preview-resources APPSETMANIFEST",
 		Short: "Preview Kubernetes resource(s) generated from an ApplicationSet/Application",
@@ -50,11 +65,174 @@ func PreviewAppSetResourcesCommand() *cobra.Command {
 				os.Exit(1)
 			}
 			filename := args[0]
-			preview.PreviewResources(filename, name, kind, output)
+			ctx, cancel := commandContext(c)
+			w, closeOutput := openOutput(c, outputFile)
+			duplicates := preview.PreviewResources(ctx, w, renderOpts.options(), filename, appFilterOpts.filter(),
+				filterOpts.filter(), preview.ResourceOrder(order), output)
+			closeOutput()
+			cancel()
+			if failOnDuplicates && len(duplicates) > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+	filterOpts.addFlags(command, "preview")
+	command.Flags().StringVar(&order, "sort", "kind",
+		"Order of the resources. One of: kind (grouped by kind)|sync (Argo CD sync order)|name")
+	appFilterOpts.addFlags(command, "preview")
+	command.Flags().StringVarP(&output, "output", "o", "name",
+		"Output format. One of: name|json|yaml|table|wide|plan|jsonpath=...|go-template=...|custom-columns=...|dir=PATH")
+	command.Flags().StringVar(&outputFile, "output-file", "", "Write the output to this file instead of stdout")
+	command.Flags().BoolVar(&failOnDuplicates, "fail-on-duplicates", false,
+		"Exit with a non-zero status when resources are rendered more than once")
+	renderOpts.addFlags(command)
+	return command
+}
+
+func DiffAppSetCommand() *cobra.Command {
+	var filterOpts filterOptions
+	var appFilterOpts appFilterOptions
+	var diffOpts diffOptions
+	var outputFile string
+	var failOnDuplicates bool
+	var renderOpts renderOptions
+	command := &cobra.Command{
+		Use:   "diff APPSETMANIFEST",
+		Short: "Diff Kubernetes resource(s) generated from an ApplicationSet between two Git revisions or with a live state",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			ctx, cancel := commandContext(c)
+			w, closeOutput := openOutput(c, outputFile)
+			var duplicates []preview.DuplicateResource
+			if diffOpts.live != "" {
+				duplicates = preview.PreviewLiveDiff(ctx, w, renderOpts.options(), filename, diffOpts.live,
+					appFilterOpts.filter(), filterOpts.filter(), diffOpts.output, diffOpts.maxDiffLines)
+			} else {
+				duplicates = preview.PreviewDiff(ctx, w, renderOpts.options(), filename, diffOpts.base, diffOpts.head,
+					appFilterOpts.filter(), filterOpts.filter(), diffOpts.output, diffOpts.maxDiffLines)
+			}
+			closeOutput()
+			cancel()
+			if failOnDuplicates && len(duplicates) > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+	filterOpts.addFlags(command, "diff")
+	appFilterOpts.addFlags(command, "diff")
+	diffOpts.addFlags(command)
+	command.Flags().StringVar(&outputFile, "output-file", "", "Write the output to this file instead of stdout")
+	command.Flags().BoolVar(&failOnDuplicates, "fail-on-duplicates", false,
+		"Exit with a non-zero status when resources are rendered more than once")
+	renderOpts.addFlags(command)
+	return command
+}
+
+func ValidateAppSetCommand() *cobra.Command {
+	var filterOpts filterOptions
+	var appFilterOpts appFilterOptions
+	var schemaOpts schemaOptions
+	var outputFile string
+	var renderOpts renderOptions
+	command := &cobra.Command{
+		Use:   "validate APPSETMANIFEST",
+		Short: "Validate Kubernetes resource(s) generated from an ApplicationSet against their OpenAPI schemas",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			ctx, cancel := commandContext(c)
+			w, closeOutput := openOutput(c, outputFile)
+			valid := preview.ValidateResources(ctx, w, renderOpts.options(), schemaOpts.options(), filename,
+				appFilterOpts.filter(), filterOpts.filter())
+			closeOutput()
+			cancel()
+			if !valid {
+				os.Exit(1)
+			}
+		},
+	}
+	filterOpts.addFlags(command, "validate")
+	appFilterOpts.addFlags(command, "validate")
+	schemaOpts.addFlags(command)
+	command.Flags().StringVar(&outputFile, "output-file", "", "Write the output to this file instead of stdout")
+	renderOpts.addFlags(command)
+	return command
+}
+
+func CheckAPIsAppSetCommand() *cobra.Command {
+	var filterOpts filterOptions
+	var appFilterOpts appFilterOptions
+	var targetVersion string
+	var outputFile string
+	var renderOpts renderOptions
+	command := &cobra.Command{
+		Use:   "check-apis APPSETMANIFEST",
+		Short: "Detect Kubernetes resource(s) generated from an ApplicationSet using deprecated or removed API versions",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			ctx, cancel := commandContext(c)
+			w, closeOutput := openOutput(c, outputFile)
+			supported := preview.CheckAPIs(ctx, w, renderOpts.options(), targetVersion, filename,
+				appFilterOpts.filter(), filterOpts.filter())
+			closeOutput()
+			cancel()
+			if !supported {
+				os.Exit(1)
+			}
+		},
+	}
+	filterOpts.addFlags(command, "check")
+	appFilterOpts.addFlags(command, "check")
+	command.Flags().StringVar(&targetVersion, "target-version", "",
+		"Kubernetes version to check the API versions against (e.g. 1.25). "+
+			"Defaults to the Kubernetes version of the destination cluster given with --kube-version")
+	command.Flags().StringVar(&outputFile, "output-file", "", "Write the output to this file instead of stdout")
+	renderOpts.addFlags(command)
+	return command
+}
+
+func CheckPoliciesAppSetCommand() *cobra.Command {
+	var filterOpts filterOptions
+	var appFilterOpts appFilterOptions
+	var policyOpts policyOptions
+	var outputFile string
+	var renderOpts renderOptions
+	command := &cobra.Command{
+		Use:   "check-policies APPSETMANIFEST",
+		Short: "Check Kubernetes resource(s) generated from an ApplicationSet against policy rules and admission policies",
+		Run: func(c *cobra.Command, args []string) {
+			if len(args) == 0 {
+				c.HelpFunc()(c, args)
+				os.Exit(1)
+			}
+			filename := args[0]
+			policies := policyOpts.options()
+			ctx, cancel := commandContext(c)
+			w, closeOutput := openOutput(c, outputFile)
+			compliant := preview.CheckPolicies(ctx, w, renderOpts.options(), policies, filename,
+				appFilterOpts.filter(), filterOpts.filter())
+			closeOutput()
+			cancel()
+			if !compliant {
+				os.Exit(1)
+			}
 		},
 	}
-	command.Flags().StringVarP(&kind, "kind", "k", "", "Kind of resources to preview")
-	command.Flags().StringVarP(&name, "name", "n", "", "Name of the Application to preview")
-	command.Flags().StringVarP(&output, "output", "o", "name", "Output format. One of: name|json|yaml")
+	filterOpts.addFlags(command, "check")
+	appFilterOpts.addFlags(command, "check")
+	policyOpts.addFlags(command)
+	command.Flags().StringVar(&outputFile, "output-file", "", "Write the output to this file instead of stdout")
+	renderOpts.addFlags(command)
 	return command
 }
@@ -0,0 +1,322 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/touchardv/argocd-offline-cli/preview"
+)
+
+// renderOptions holds the flags shared by the commands rendering resources
+type renderOptions struct {
+	parallelism         int
+	appTimeout          time.Duration
+	trackingMethod      string
+	appInstanceLabelKey string
+	argoCDConfigMap     string
+	argoCDCmdParams     string
+	projects            string
+	kubeVersions        []string
+	apiVersions         []string
+	apiVersionsFiles    []string
+	plugins             []string
+	injectNamespace     bool
+}
+
+func (o *renderOptions) addFlags(command *cobra.Command) {
+	command.Flags().IntVar(&o.parallelism, "parallelism", 1, "Maximum number of Applications rendered concurrently")
+	command.Flags().DurationVar(&o.appTimeout, "app-timeout", 0,
+		"Maximum time spent rendering a single Application (e.g. 2m). Zero means no timeout")
+	command.Flags().StringVar(&o.trackingMethod, "tracking-method", "",
+		"Inject the Argo CD resource tracking metadata using this method. One of: annotation|label|annotation+label. "+
+			"Defaults to the tracking method of --argocd-cm, if set")
+	command.Flags().StringVar(&o.appInstanceLabelKey, "app-instance-label-key", "",
+		"Label used by the label and annotation+label tracking methods "+
+			"(default: the instance label key of --argocd-cm, or else app.kubernetes.io/instance)")
+	command.Flags().StringVar(&o.argoCDConfigMap, "argocd-cm", "",
+		"argocd-cm ConfigMap manifest whose settings are applied (Kustomize, Helm, tracking, resource exclusions...)")
+	command.Flags().StringVar(&o.argoCDCmdParams, "argocd-cmd-params-cm", "",
+		"argocd-cmd-params-cm ConfigMap manifest whose repo server parameters are applied")
+	command.Flags().StringVar(&o.projects, "projects", "",
+		"AppProject manifests the Applications are validated against (source repos, destinations, resource lists...)")
+	command.Flags().StringArrayVar(&o.kubeVersions, "kube-version", nil,
+		"Kubernetes version passed to Helm and Kustomize (e.g. 1.30). Prefix with CLUSTER= (a destination server URL "+
+			"or name) to only apply it to that cluster. Can be repeated")
+	command.Flags().StringArrayVar(&o.apiVersions, "api-versions", nil,
+		"API versions passed to Helm and Kustomize, comma separated (e.g. monitoring.coreos.com/v1). "+
+			"Prefix with CLUSTER= to only apply them to that cluster. Can be repeated")
+	command.Flags().StringArrayVar(&o.apiVersionsFiles, "api-versions-file", nil,
+		"File listing the API versions passed to Helm and Kustomize, the output of kubectl api-versions or "+
+			"kubectl api-resources. Prefix with CLUSTER= to only apply them to that cluster. Can be repeated")
+	command.Flags().StringArrayVar(&o.plugins, "plugin", nil,
+		"Config Management Plugin run locally for the sources using a plugin: a plugin.yaml, or a ConfigMap "+
+			"holding plugin.yaml files. Can be repeated")
+	command.Flags().BoolVar(&o.injectNamespace, "inject-namespace", false,
+		"Place the namespaced resources without a namespace in the destination namespace, as Argo CD does, "+
+			"and warn about the resources targeting another namespace")
+}
+
+func (o *renderOptions) options() preview.Options {
+	var settings *preview.ArgoCDSettings
+	if o.argoCDConfigMap != "" || o.argoCDCmdParams != "" {
+		var err error
+		settings, err = preview.LoadArgoCDSettings(o.argoCDConfigMap, o.argoCDCmdParams)
+		errors.CheckError(err)
+	}
+	var projects []argoappv1.AppProject
+	if o.projects != "" {
+		var err error
+		projects, err = preview.LoadAppProjects(o.projects)
+		errors.CheckError(err)
+	}
+	var plugins []preview.PluginConfig
+	for _, filename := range o.plugins {
+		configs, err := preview.LoadPluginConfigs(filename)
+		errors.CheckError(err)
+		plugins = append(plugins, configs...)
+	}
+	capabilities, clusterCapabilities := o.capabilities()
+	return preview.Options{
+		Parallelism:         o.parallelism,
+		AppTimeout:          o.appTimeout,
+		TrackingMethod:      o.trackingMethod,
+		AppInstanceLabelKey: o.appInstanceLabelKey,
+		Settings:            settings,
+		Projects:            projects,
+		Capabilities:        capabilities,
+		ClusterCapabilities: clusterCapabilities,
+		Plugins:             plugins,
+		InjectNamespace:     o.injectNamespace,
+	}
+}
+
+// capabilities returns the default capabilities and the capabilities of the clusters given with a CLUSTER= prefix.
+// The API versions given for the same cluster are merged.
+func (o *renderOptions) capabilities() (preview.Capabilities, map[string]preview.Capabilities) {
+	byCluster := map[string]*preview.Capabilities{"": {}}
+	get := func(cluster string) *preview.Capabilities {
+		if byCluster[cluster] == nil {
+			byCluster[cluster] = &preview.Capabilities{}
+		}
+		return byCluster[cluster]
+	}
+	for _, value := range o.kubeVersions {
+		cluster, kubeVersion := splitClusterValue(value)
+		get(cluster).KubeVersion = kubeVersion
+	}
+	for _, value := range o.apiVersions {
+		cluster, apiVersions := splitClusterValue(value)
+		capabilities := get(cluster)
+		for _, apiVersion := range strings.Split(apiVersions, ",") {
+			if apiVersion = strings.TrimSpace(apiVersion); apiVersion != "" {
+				capabilities.APIVersions = append(capabilities.APIVersions, apiVersion)
+			}
+		}
+	}
+	for _, value := range o.apiVersionsFiles {
+		cluster, filename := splitClusterFile(value)
+		apiVersions, err := preview.LoadAPIVersions(filename)
+		errors.CheckError(err)
+		capabilities := get(cluster)
+		capabilities.APIVersions = append(capabilities.APIVersions, apiVersions...)
+	}
+
+	var clusterCapabilities map[string]preview.Capabilities
+	for cluster, capabilities := range byCluster {
+		if cluster == "" {
+			continue
+		}
+		if clusterCapabilities == nil {
+			clusterCapabilities = map[string]preview.Capabilities{}
+		}
+		clusterCapabilities[cluster] = *capabilities
+	}
+	return *byCluster[""], clusterCapabilities
+}
+
+// splitClusterValue splits a flag value prefixed with CLUSTER= into the cluster and the value.
+// The cluster is empty when there is no prefix.
+func splitClusterValue(value string) (string, string) {
+	if cluster, v, ok := strings.Cut(value, "="); ok {
+		return cluster, v
+	}
+	return "", value
+}
+
+// splitClusterFile splits a filename flag value prefixed with CLUSTER= into the cluster and the filename.
+// A value naming an existing file is a filename without prefix, even if it contains =.
+func splitClusterFile(value string) (string, string) {
+	if _, err := os.Stat(value); err == nil {
+		return "", value
+	}
+	return splitClusterValue(value)
+}
+
+// commandContext returns the command context, bounded by the --timeout flag when set
+func commandContext(c *cobra.Command) (context.Context, context.CancelFunc) {
+	ctx := c.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	timeout, err := c.Flags().GetDuration("timeout")
+	if err != nil || timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// openOutput returns the writer the command output goes to, the --output-file when set or stdout otherwise,
+// and a function closing it. The output is written to a temporary file next to the --output-file, renamed to
+// it when closed, so that a command exiting on an error leaves the --output-file untouched.
+func openOutput(c *cobra.Command, outputFile string) (io.Writer, func()) {
+	if outputFile == "" {
+		return c.OutOrStdout(), func() {}
+	}
+	outputFile = filepath.Clean(outputFile)
+	f, err := os.CreateTemp(filepath.Dir(outputFile), "."+filepath.Base(outputFile)+".*")
+	errors.CheckError(err)
+	log.RegisterExitHandler(func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	})
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(outputFile); err == nil {
+		mode = info.Mode().Perm()
+	}
+	errors.CheckError(f.Chmod(mode))
+	return f, func() {
+		errors.CheckError(f.Close())
+		errors.CheckError(os.Rename(f.Name(), outputFile))
+	}
+}
+
+// appFilterOptions holds the flags selecting the Applications
+type appFilterOptions struct {
+	names    []string
+	selector string
+}
+
+func (o *appFilterOptions) addFlags(command *cobra.Command, verb string) {
+	command.Flags().StringArrayVarP(&o.names, "name", "n", nil,
+		"Name of the Application(s) to "+verb+": a glob (e.g. team-x-*) or a regular expression enclosed in slashes. "+
+			"Can be repeated")
+	command.Flags().StringVarP(&o.selector, "selector", "l", "",
+		"Label selector of the Application(s) to "+verb+" (e.g. team=x,env=staging)")
+}
+
+func (o *appFilterOptions) filter() preview.AppFilter {
+	return preview.AppFilter{
+		Names:    o.names,
+		Selector: o.selector,
+	}
+}
+
+// filterOptions holds the flags selecting the rendered resources
+type filterOptions struct {
+	kind        string
+	group       string
+	namespace   string
+	name        string
+	selector    string
+	annotations []string
+}
+
+func (o *filterOptions) addFlags(command *cobra.Command, verb string) {
+	command.Flags().StringVarP(&o.kind, "kind", "k", "",
+		"Kind(s) of resources to "+verb+", comma separated. Accepts plural, short names and kind.group (e.g. deploy,svc)")
+	command.Flags().StringVar(&o.group, "group", "", "API group of resources to "+verb+" (core for the core group)")
+	command.Flags().StringVar(&o.namespace, "namespace", "", "Namespace of resources to "+verb)
+	command.Flags().StringVar(&o.name, "resource-name", "",
+		"Name of resources to "+verb+": a glob (e.g. web-*) or a regular expression enclosed in slashes (e.g. /^web-/)")
+	command.Flags().StringVar(&o.selector, "resource-selector", "",
+		"Label selector of resources to "+verb+" (e.g. app=web,tier!=cache)")
+	command.Flags().StringArrayVar(&o.annotations, "has-annotation", nil,
+		"Only "+verb+" resources having this annotation (can be repeated)")
+}
+
+func (o *filterOptions) filter() preview.ResourceFilter {
+	return preview.ResourceFilter{
+		Kind:        o.kind,
+		Group:       o.group,
+		Namespace:   o.namespace,
+		Name:        o.name,
+		Selector:    o.selector,
+		Annotations: o.annotations,
+	}
+}
+
+// diffOptions holds the flags selecting what rendered manifests are compared to
+type diffOptions struct {
+	base         string
+	head         string
+	live         string
+	output       string
+	maxDiffLines int
+}
+
+func (o *diffOptions) addFlags(command *cobra.Command) {
+	command.Flags().StringVar(&o.base, "base", "", "Git revision of the local repository to compare from (e.g. main)")
+	command.Flags().StringVar(&o.head, "head", "HEAD", "Git revision of the local repository to compare to")
+	command.Flags().StringVar(&o.live, "live", "",
+		"Compare with a snapshot of the live resources (e.g. exported with kubectl get -o yaml) instead of a revision")
+	command.Flags().StringVarP(&o.output, "output", "o", "text", "Output format. One of: text|markdown|html")
+	command.Flags().IntVar(&o.maxDiffLines, "max-diff-lines", 50,
+		"Truncate the diff of each resource in markdown and html reports to this number of lines. Zero means no limit")
+	command.MarkFlagsMutuallyExclusive("base", "live")
+	command.MarkFlagsOneRequired("base", "live")
+}
+
+// schemaOptions holds the flags selecting the schemas rendered resources are validated against
+type schemaOptions struct {
+	schemaDir string
+	crdFiles  []string
+}
+
+func (o *schemaOptions) addFlags(command *cobra.Command) {
+	command.Flags().StringVar(&o.schemaDir, "schemas", "",
+		"Directory of the OpenAPI documents of the Kubernetes version to validate against "+
+			"(e.g. api/openapi-spec/v3 of the Kubernetes repository). Defaults to the bundled Kubernetes schemas")
+	command.Flags().StringArrayVar(&o.crdFiles, "crd", nil,
+		"File of CustomResourceDefinitions to validate custom resources against (can be repeated)")
+}
+
+func (o *schemaOptions) options() preview.SchemaOptions {
+	return preview.SchemaOptions{SchemaDir: o.schemaDir, CRDFiles: o.crdFiles}
+}
+
+// policyOptions holds the flags selecting the policies rendered resources are checked against
+type policyOptions struct {
+	policyFiles    []string
+	admissionFiles []string
+}
+
+func (o *policyOptions) addFlags(command *cobra.Command) {
+	command.Flags().StringArrayVar(&o.policyFiles, "policy", nil, "File of policy rules to check (can be repeated)")
+	command.Flags().StringArrayVar(&o.admissionFiles, "admission-policy", nil,
+		"File of ValidatingAdmissionPolicies and bindings to check, along with their parameters (can be repeated)")
+	command.MarkFlagsOneRequired("policy", "admission-policy")
+}
+
+// options loads the policy rules and the admission policies of the files
+func (o *policyOptions) options() preview.PolicyOptions {
+	var opts preview.PolicyOptions
+	for _, filename := range o.policyFiles {
+		rules, err := preview.LoadPolicyRules(filename)
+		errors.CheckError(err)
+		opts.Rules = append(opts.Rules, rules...)
+	}
+	for _, filename := range o.admissionFiles {
+		policies, err := preview.LoadAdmissionPolicies(filename)
+		errors.CheckError(err)
+		opts.AdmissionPolicies = append(opts.AdmissionPolicies, policies)
+	}
+	return opts
+}
@@ -24,6 +24,8 @@ to preview the Kubernetes resource manifests being created and managed by Argo C
 
 	// Enable -v as shorthand for --version
 	rootCmd.Flags().BoolP("version", "v", false, "version for argocd-offline-cli")
+	rootCmd.PersistentFlags().Duration("timeout", 0,
+		"Maximum duration of the whole command (e.g. 5m). Zero means no timeout")
 
 	rootCmd.AddCommand(AppSetCommand())
 	rootCmd.AddCommand(AppCommand())
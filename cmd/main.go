@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"os"
+	"os/signal"
+	"syscall"
 
 	cmd "github.com/touchardv/argocd-offline-cli/cmd/commands"
 )
 
 func main() {
+	// Cancel in-flight rendering on Ctrl-C so that partial work is cleaned up
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	command := cmd.NewCommand()
-	if err := command.Execute(); err != nil {
+	err := command.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,657 @@
+package preview
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	"github.com/google/cel-go/cel"
+	log "github.com/sirupsen/logrus"
+	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Kinds of the admission policies
+const (
+	admissionRegistrationGroup           = "admissionregistration.k8s.io"
+	validatingAdmissionPolicyKind        = "ValidatingAdmissionPolicy"
+	validatingAdmissionPolicyBindingKind = "ValidatingAdmissionPolicyBinding"
+)
+
+// Variables of the ValidatingAdmissionPolicy expressions. Without an API server to ask, authorizer is declared
+// but left undefined, failing the expressions using it.
+const (
+	celVariableOldObject       = "oldObject"
+	celVariableRequest         = "request"
+	celVariableParams          = "params"
+	celVariableNamespaceObject = "namespaceObject"
+	celVariableVariables       = "variables"
+	celVariableAuthorizer      = "authorizer"
+)
+
+// admissionOperation is the operation resources are admitted for, as when Argo CD first syncs them
+const admissionOperation = admissionregistrationv1.Create
+
+// AdmissionPolicies are ValidatingAdmissionPolicies and bindings, along with the resources they may take as
+// parameters, with the expressions of the policies compiled. They are built by LoadAdmissionPolicies or
+// CompileAdmissionPolicies.
+type AdmissionPolicies struct {
+	resources []*unstructured.Unstructured
+	policies  map[string]*admissionPolicy
+}
+
+// LoadAdmissionPolicies loads and compiles the ValidatingAdmissionPolicies and bindings of a manifest file,
+// along with the other resources of the file, which may be the parameters of the policies
+func LoadAdmissionPolicies(filename string) (*AdmissionPolicies, error) {
+	manifests, err := loadManifestsFile(filename, "admission policies")
+	if err != nil {
+		return nil, err
+	}
+	policies, err := CompileAdmissionPolicies(manifests)
+	if err != nil {
+		return nil, fmt.Errorf("invalid admission policies %s: %w", filename, err)
+	}
+	return policies, nil
+}
+
+// CompileAdmissionPolicies compiles the ValidatingAdmissionPolicies among the resources, and validates the
+// bindings. The other resources may be the parameters of the policies.
+func CompileAdmissionPolicies(resources []*unstructured.Unstructured) (*AdmissionPolicies, error) {
+	env, err := newAdmissionCELEnv()
+	if err != nil {
+		return nil, err
+	}
+	policies := &AdmissionPolicies{resources: resources, policies: map[string]*admissionPolicy{}}
+	found := false
+	for _, resource := range resources {
+		switch {
+		case isAdmissionKind(resource, validatingAdmissionPolicyKind):
+			policy, err := parseAdmissionPolicy(resource)
+			if err != nil {
+				return nil, err
+			}
+			if policies.policies[policy.Name], err = compileAdmissionPolicy(env, policy); err != nil {
+				return nil, err
+			}
+		case isAdmissionKind(resource, validatingAdmissionPolicyBindingKind):
+			if _, err := parseAdmissionPolicyBinding(resource); err != nil {
+				return nil, err
+			}
+		default:
+			continue
+		}
+		found = true
+	}
+	if !found {
+		return nil, fmt.Errorf("no ValidatingAdmissionPolicy or ValidatingAdmissionPolicyBinding found")
+	}
+	return policies, nil
+}
+
+// isAdmissionKind returns true if the resource is of the given admissionregistration.k8s.io kind, in any version
+func isAdmissionKind(resource *unstructured.Unstructured, kind string) bool {
+	gvk := resource.GroupVersionKind()
+	return gvk.Group == admissionRegistrationGroup && gvk.Kind == kind
+}
+
+// parseAdmissionPolicy converts a ValidatingAdmissionPolicy manifest. The beta versions have the same fields.
+func parseAdmissionPolicy(
+	resource *unstructured.Unstructured,
+) (*admissionregistrationv1.ValidatingAdmissionPolicy, error) {
+	var policy admissionregistrationv1.ValidatingAdmissionPolicy
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(resource.Object, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse ValidatingAdmissionPolicy %s: %w", resource.GetName(), err)
+	}
+	return &policy, nil
+}
+
+// parseAdmissionPolicyBinding converts a ValidatingAdmissionPolicyBinding manifest
+func parseAdmissionPolicyBinding(
+	resource *unstructured.Unstructured,
+) (*admissionregistrationv1.ValidatingAdmissionPolicyBinding, error) {
+	var binding admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(resource.Object, &binding); err != nil {
+		return nil, fmt.Errorf("failed to parse ValidatingAdmissionPolicyBinding %s: %w", resource.GetName(), err)
+	}
+	return &binding, nil
+}
+
+// newAdmissionCELEnv returns the CEL environment of the ValidatingAdmissionPolicy expressions
+func newAdmissionCELEnv() (*cel.Env, error) {
+	return newCELEnv(celVariableObject, celVariableOldObject, celVariableRequest, celVariableParams,
+		celVariableNamespaceObject, celVariableVariables, celVariableAuthorizer)
+}
+
+// namedProgram is a compiled expression of a ValidatingAdmissionPolicy variable or match condition
+type namedProgram struct {
+	name    string
+	program cel.Program
+}
+
+// admissionValidation is a compiled validation of a ValidatingAdmissionPolicy
+type admissionValidation struct {
+	validation admissionregistrationv1.Validation
+	expression cel.Program
+	message    cel.Program
+}
+
+// admissionPolicy is a ValidatingAdmissionPolicy ready to be evaluated
+type admissionPolicy struct {
+	policy          *admissionregistrationv1.ValidatingAdmissionPolicy
+	matchConditions []namedProgram
+	variables       []namedProgram
+	validations     []admissionValidation
+}
+
+// compileAdmissionPolicy compiles the expressions of a ValidatingAdmissionPolicy
+func compileAdmissionPolicy(
+	env *cel.Env,
+	policy *admissionregistrationv1.ValidatingAdmissionPolicy,
+) (*admissionPolicy, error) {
+	compiled := &admissionPolicy{policy: policy}
+	for _, condition := range policy.Spec.MatchConditions {
+		program, err := compileCEL(env, condition.Expression, cel.BoolType)
+		if err != nil {
+			return nil, fmt.Errorf("ValidatingAdmissionPolicy %s: match condition %s: %w", policy.Name, condition.Name, err)
+		}
+		compiled.matchConditions = append(compiled.matchConditions, namedProgram{name: condition.Name, program: program})
+	}
+	for _, variable := range policy.Spec.Variables {
+		program, err := compileCEL(env, variable.Expression, cel.DynType)
+		if err != nil {
+			return nil, fmt.Errorf("ValidatingAdmissionPolicy %s: variable %s: %w", policy.Name, variable.Name, err)
+		}
+		compiled.variables = append(compiled.variables, namedProgram{name: variable.Name, program: program})
+	}
+	for _, validation := range policy.Spec.Validations {
+		c := admissionValidation{validation: validation}
+		var err error
+		if c.expression, err = compileCEL(env, validation.Expression, cel.BoolType); err != nil {
+			return nil, fmt.Errorf("ValidatingAdmissionPolicy %s: %w", policy.Name, err)
+		}
+		if validation.MessageExpression != "" {
+			if c.message, err = compileCEL(env, validation.MessageExpression, cel.StringType); err != nil {
+				return nil, fmt.Errorf("ValidatingAdmissionPolicy %s: %w", policy.Name, err)
+			}
+		}
+		compiled.validations = append(compiled.validations, c)
+	}
+	return compiled, nil
+}
+
+// ignoresFailures returns true if the evaluation errors of the policy are ignored rather than rejecting resources
+func (p *admissionPolicy) ignoresFailures() bool {
+	return p.policy.Spec.FailurePolicy != nil && *p.policy.Spec.FailurePolicy == admissionregistrationv1.Ignore
+}
+
+// evaluate returns the failure messages of the validations of the policy, after evaluating its match conditions
+// and variables. Evaluation errors are failures, unless the failure policy ignores them.
+func (p *admissionPolicy) evaluate(vars map[string]any) []string {
+	var failures []string
+	fail := func(message string) {
+		if !p.ignoresFailures() {
+			failures = append(failures, message)
+		}
+	}
+	for _, condition := range p.matchConditions {
+		matches, err := evalBool(condition.program, vars)
+		if err != nil {
+			fail(fmt.Sprintf("match condition '%s' resulted in error: %v", condition.name, err))
+			return failures
+		}
+		if !matches {
+			return nil
+		}
+	}
+
+	// Variables may refer to the previous ones. Those failing to evaluate are left undefined, failing the
+	// expressions referring to them.
+	variables := map[string]any{}
+	vars[celVariableVariables] = variables
+	for _, variable := range p.variables {
+		out, _, err := variable.program.Eval(vars)
+		if err != nil {
+			log.Debugf("ValidatingAdmissionPolicy %s: variable %s: %v", p.policy.Name, variable.name, err)
+			continue
+		}
+		variables[variable.name] = out
+	}
+
+	for _, v := range p.validations {
+		valid, err := evalBool(v.expression, vars)
+		if err != nil {
+			fail(fmt.Sprintf("expression '%s' resulted in error: %v", v.validation.Expression, err))
+			continue
+		}
+		if !valid {
+			failures = append(failures, failureMessage(v.message, v.validation.Message, v.validation.Expression, vars))
+		}
+	}
+	return failures
+}
+
+// admissionBinding is a ValidatingAdmissionPolicyBinding with the policy it binds
+type admissionBinding struct {
+	binding  *admissionregistrationv1.ValidatingAdmissionPolicyBinding
+	policy   *admissionPolicy
+	severity string
+}
+
+// bindingSeverity returns the severity of the failures of a binding: error when they are denied, warning when
+// they are only reported to the client, info when they are only audited
+func bindingSeverity(binding *admissionregistrationv1.ValidatingAdmissionPolicyBinding) (string, error) {
+	switch {
+	case slices.Contains(binding.Spec.ValidationActions, admissionregistrationv1.Deny):
+		return SeverityError, nil
+	case slices.Contains(binding.Spec.ValidationActions, admissionregistrationv1.Warn):
+		return SeverityWarning, nil
+	case slices.Contains(binding.Spec.ValidationActions, admissionregistrationv1.Audit):
+		return SeverityInfo, nil
+	default:
+		return "", fmt.Errorf("ValidatingAdmissionPolicyBinding %s has no validation action", binding.Name)
+	}
+}
+
+// admissionCluster holds the admission policies enforced by a cluster and the resources they may refer to
+type admissionCluster struct {
+	bindings []admissionBinding
+	// resources are the resources known to be in the cluster, parameters and namespaces
+	resources []*unstructured.Unstructured
+	scopes    resourceScopes
+	// plurals are the resource names of the custom resource kinds, as declared by their CRD
+	plurals map[schema.GroupKind]string
+}
+
+// admissionChecker evaluates the ValidatingAdmissionPolicies of the destination clusters of the Applications
+type admissionChecker struct {
+	clusters map[string]*admissionCluster
+}
+
+// newAdmissionChecker returns a checker of the admission policies given along with their parameters, and of
+// those rendered for each destination cluster, whose parameters may also be rendered. The given policies are
+// already compiled, only the rendered ones are compiled for each cluster.
+func newAdmissionChecker(
+	given []*AdmissionPolicies,
+	apps []argoappv1.Application,
+	rendered [][]*unstructured.Unstructured,
+) (*admissionChecker, error) {
+	env, err := newAdmissionCELEnv()
+	if err != nil {
+		return nil, err
+	}
+	byCluster := map[string][]*unstructured.Unstructured{}
+	for i, resources := range rendered {
+		cluster := destinationKey(apps[i])
+		scopes := newResourceScopes(resources)
+		for _, resource := range resources {
+			// The rendered resources without a namespace end up in the destination namespace
+			if key := appResourceKey(apps[i], scopes, resource); key.Namespace != resource.GetNamespace() {
+				resource = resource.DeepCopy()
+				resource.SetNamespace(key.Namespace)
+			}
+			byCluster[cluster] = append(byCluster[cluster], resource)
+		}
+	}
+
+	var givenResources []*unstructured.Unstructured
+	givenPolicies := map[string]*admissionPolicy{}
+	for _, policies := range given {
+		if policies == nil {
+			continue
+		}
+		givenResources = append(givenResources, policies.resources...)
+		maps.Copy(givenPolicies, policies.policies)
+	}
+
+	c := &admissionChecker{clusters: map[string]*admissionCluster{}}
+	for cluster, resources := range byCluster {
+		c.clusters[cluster], err = newAdmissionCluster(env, givenResources, givenPolicies, resources)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// newAdmissionCluster compiles the admission policies among the rendered resources of a cluster, which are
+// checked along with the given compiled policies and their resources
+func newAdmissionCluster(
+	env *cel.Env,
+	givenResources []*unstructured.Unstructured,
+	givenPolicies map[string]*admissionPolicy,
+	rendered []*unstructured.Unstructured,
+) (*admissionCluster, error) {
+	resources := append(slices.Clone(givenResources), rendered...)
+	c := &admissionCluster{
+		resources: resources,
+		scopes:    newResourceScopes(resources),
+		plurals:   map[schema.GroupKind]string{},
+	}
+	policies := maps.Clone(givenPolicies)
+	for _, resource := range resources {
+		if kind, ok := crdKind(resource); ok {
+			plural, _, _ := unstructured.NestedString(resource.Object, "spec", "names", "plural")
+			c.plurals[kind] = plural
+		}
+	}
+	for _, resource := range rendered {
+		if !isAdmissionKind(resource, validatingAdmissionPolicyKind) {
+			continue
+		}
+		policy, err := parseAdmissionPolicy(resource)
+		if err != nil {
+			return nil, err
+		}
+		if policies[policy.Name], err = compileAdmissionPolicy(env, policy); err != nil {
+			return nil, err
+		}
+	}
+	for _, resource := range resources {
+		if !isAdmissionKind(resource, validatingAdmissionPolicyBindingKind) {
+			continue
+		}
+		binding, err := parseAdmissionPolicyBinding(resource)
+		if err != nil {
+			return nil, err
+		}
+		policy := policies[binding.Spec.PolicyName]
+		if policy == nil {
+			log.Warnf("ValidatingAdmissionPolicyBinding %s: ValidatingAdmissionPolicy %s not found",
+				binding.Name, binding.Spec.PolicyName)
+			continue
+		}
+		severity, err := bindingSeverity(binding)
+		if err != nil {
+			return nil, err
+		}
+		c.bindings = append(c.bindings, admissionBinding{binding: binding, policy: policy, severity: severity})
+	}
+	return c, nil
+}
+
+// crdKind returns the group and kind of the custom resources defined by a CRD
+func crdKind(resource *unstructured.Unstructured) (schema.GroupKind, bool) {
+	if !kube.IsCRD(resource) {
+		return schema.GroupKind{}, false
+	}
+	group, _, _ := unstructured.NestedString(resource.Object, "spec", "group")
+	kind, _, _ := unstructured.NestedString(resource.Object, "spec", "names", "kind")
+	return schema.GroupKind{Group: group, Kind: kind}, true
+}
+
+// admissionRequest is a rendered resource as submitted to the admission policies of its cluster
+type admissionRequest struct {
+	object     *unstructured.Unstructured
+	resource   schema.GroupVersionResource
+	namespaced bool
+}
+
+// newAdmissionRequest returns the admission request of a rendered resource, placed in the destination namespace
+// of its Application if it has none
+func (c *admissionCluster) newAdmissionRequest(
+	app argoappv1.Application,
+	resource *unstructured.Unstructured,
+) admissionRequest {
+	gvk := resource.GroupVersionKind()
+	request := admissionRequest{object: resource, namespaced: c.scopes.isNamespaced(gvk.GroupKind())}
+	if plural, ok := c.plurals[gvk.GroupKind()]; ok && plural != "" {
+		request.resource = gvk.GroupVersion().WithResource(plural)
+	} else {
+		request.resource, _ = meta.UnsafeGuessKindToResource(gvk)
+	}
+	if request.namespaced && resource.GetNamespace() == "" {
+		request.object = resource.DeepCopy()
+		request.object.SetNamespace(app.Spec.Destination.Namespace)
+	}
+	return request
+}
+
+// vars returns the variables of the admission policy expressions, except the params
+func (r admissionRequest) vars(namespace *unstructured.Unstructured) map[string]any {
+	gvk := r.object.GroupVersionKind()
+	vars := map[string]any{
+		celVariableObject:    r.object.Object,
+		celVariableOldObject: nil,
+		celVariableRequest: map[string]any{
+			"kind":      map[string]any{"group": gvk.Group, "version": gvk.Version, "kind": gvk.Kind},
+			"resource":  map[string]any{"group": gvk.Group, "version": gvk.Version, "resource": r.resource.Resource},
+			"name":      r.object.GetName(),
+			"namespace": r.object.GetNamespace(),
+			"operation": string(admissionOperation),
+			"userInfo":  map[string]any{},
+			"dryRun":    false,
+		},
+		celVariableNamespaceObject: nil,
+		celVariableParams:          nil,
+	}
+	if namespace != nil {
+		vars[celVariableNamespaceObject] = namespace.Object
+	}
+	return vars
+}
+
+// namespace returns the Namespace of a namespaced resource: the rendered one, or else a Namespace with only
+// the name label set by the API server
+func (c *admissionCluster) namespace(request admissionRequest) *unstructured.Unstructured {
+	if !request.namespaced {
+		return nil
+	}
+	name := request.object.GetNamespace()
+	for _, resource := range c.resources {
+		if resource.GroupVersionKind() == corev1Namespace && resource.GetName() == name {
+			return resource
+		}
+	}
+	namespace := &unstructured.Unstructured{}
+	namespace.SetGroupVersionKind(corev1Namespace)
+	namespace.SetName(name)
+	namespace.SetLabels(map[string]string{corev1.LabelMetadataName: name})
+	return namespace
+}
+
+// corev1Namespace is the kind of the Namespaces
+var corev1Namespace = schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}
+
+// check returns the failures of the admission policies bound to a resource
+func (c *admissionCluster) check(app argoappv1.Application, resource *unstructured.Unstructured) []policyViolation {
+	request := c.newAdmissionRequest(app, resource)
+	namespace := c.namespace(request)
+	var violations []policyViolation
+	for _, b := range c.bindings {
+		constraints := b.policy.policy.Spec.MatchConstraints
+		if constraints == nil || len(constraints.ResourceRules) == 0 ||
+			!matchesResources(constraints, request, namespace) {
+			continue
+		}
+		if b.binding.Spec.MatchResources != nil && !matchesResources(b.binding.Spec.MatchResources, request, namespace) {
+			continue
+		}
+		name := fmt.Sprintf("%s (%s)", b.policy.policy.Name, b.binding.Name)
+		violation := policyViolation{appName: app.Name, resource: resource, policy: name, severity: b.severity}
+
+		params, err := c.params(b, request)
+		if err != nil {
+			if !b.policy.ignoresFailures() {
+				violation.message = err.Error()
+				violations = append(violations, violation)
+			}
+			continue
+		}
+		for _, param := range params {
+			vars := request.vars(namespace)
+			if param != nil {
+				vars[celVariableParams] = param.Object
+			}
+			for _, message := range b.policy.evaluate(vars) {
+				violation.message = message
+				violations = append(violations, violation)
+			}
+		}
+	}
+	return violations
+}
+
+// params returns the parameters a binding refers to, a nil parameter when the policy has none, or no parameter
+// when they are not found but allowed to be missing
+func (c *admissionCluster) params(b admissionBinding, request admissionRequest) ([]*unstructured.Unstructured, error) {
+	paramKind := b.policy.policy.Spec.ParamKind
+	if paramKind == nil {
+		return []*unstructured.Unstructured{nil}, nil
+	}
+	ref := b.binding.Spec.ParamRef
+	if ref == nil {
+		return nil, fmt.Errorf("ValidatingAdmissionPolicyBinding %s has no paramRef to a %s", b.binding.Name, paramKind.Kind)
+	}
+	gvk := schema.FromAPIVersionAndKind(paramKind.APIVersion, paramKind.Kind)
+	namespace := ref.Namespace
+	if c.scopes.isNamespaced(gvk.GroupKind()) && namespace == "" {
+		if !request.namespaced {
+			return nil, fmt.Errorf("ValidatingAdmissionPolicyBinding %s: no namespace to look %s params up for "+
+				"a cluster-scoped resource", b.binding.Name, paramKind.Kind)
+		}
+		namespace = request.object.GetNamespace()
+	}
+	selector := labels.Everything()
+	if ref.Name == "" && ref.Selector != nil {
+		var err error
+		if selector, err = metav1.LabelSelectorAsSelector(ref.Selector); err != nil {
+			return nil, fmt.Errorf("ValidatingAdmissionPolicyBinding %s: invalid param selector: %w", b.binding.Name, err)
+		}
+	}
+
+	var params []*unstructured.Unstructured
+	for _, resource := range c.resources {
+		if resource.GroupVersionKind() != gvk || resource.GetNamespace() != namespace {
+			continue
+		}
+		if ref.Name != "" && resource.GetName() != ref.Name {
+			continue
+		}
+		if selector.Matches(labels.Set(resource.GetLabels())) {
+			params = append(params, resource)
+		}
+	}
+	if len(params) > 0 {
+		return params, nil
+	}
+	if ref.ParameterNotFoundAction != nil && *ref.ParameterNotFoundAction == admissionregistrationv1.AllowAction {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("no params found for policy binding with `Deny` parameterNotFoundAction")
+}
+
+// matchesResources returns true if the resource is matched by the rules and selectors of a policy or binding
+func matchesResources(
+	match *admissionregistrationv1.MatchResources,
+	request admissionRequest,
+	namespace *unstructured.Unstructured,
+) bool {
+	if !matchesSelector(match.ObjectSelector, request.object.GetLabels()) {
+		return false
+	}
+	// The namespace selector applies to the namespaced resources and to the Namespaces themselves
+	switch {
+	case namespace != nil:
+		if !matchesSelector(match.NamespaceSelector, namespace.GetLabels()) {
+			return false
+		}
+	case request.object.GroupVersionKind() == corev1Namespace:
+		if !matchesSelector(match.NamespaceSelector, request.object.GetLabels()) {
+			return false
+		}
+	}
+	for _, rule := range match.ExcludeResourceRules {
+		if matchesRule(rule, request) {
+			return false
+		}
+	}
+	// A binding without resource rules applies to all the resources its policy matches
+	if len(match.ResourceRules) == 0 {
+		return true
+	}
+	for _, rule := range match.ResourceRules {
+		if matchesRule(rule, request) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesSelector returns true if the labels are selected, a nil selector selecting everything
+func matchesSelector(selector *metav1.LabelSelector, set map[string]string) bool {
+	if selector == nil {
+		return true
+	}
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		log.Warnf("Invalid label selector %s: %v", metav1.FormatLabelSelector(selector), err)
+		return false
+	}
+	return s.Matches(labels.Set(set))
+}
+
+// matchesRule returns true if the rule applies to the resource, as created
+func matchesRule(rule admissionregistrationv1.NamedRuleWithOperations, request admissionRequest) bool {
+	if !slices.Contains(rule.Operations, admissionOperation) &&
+		!slices.Contains(rule.Operations, admissionregistrationv1.OperationAll) {
+		return false
+	}
+	gvr := request.resource
+	if !matchesAny(rule.APIGroups, gvr.Group, "*") || !matchesAny(rule.APIVersions, gvr.Version, "*") {
+		return false
+	}
+	if !matchesAny(rule.Resources, gvr.Resource, "*", "*/*", gvr.Resource+"/*") {
+		return false
+	}
+	if rule.Scope != nil {
+		switch *rule.Scope {
+		case admissionregistrationv1.ClusterScope:
+			if request.namespaced {
+				return false
+			}
+		case admissionregistrationv1.NamespacedScope:
+			if !request.namespaced {
+				return false
+			}
+		}
+	}
+	return len(rule.ResourceNames) == 0 || slices.Contains(rule.ResourceNames, request.object.GetName())
+}
+
+// matchesAny returns true if any of the values is among the rule values
+func matchesAny(ruleValues []string, values ...string) bool {
+	for _, value := range ruleValues {
+		if slices.Contains(values, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// check returns the failures of the admission policies bound to a resource of an Application
+func (c *admissionChecker) check(app argoappv1.Application, resource *unstructured.Unstructured) []policyViolation {
+	cluster := c.clusters[destinationKey(app)]
+	if cluster == nil {
+		return nil
+	}
+	return cluster.check(app, resource)
+}
+
+// count returns the number of policy bindings of all the clusters
+func (c *admissionChecker) count() int {
+	bindings := map[string]bool{}
+	for _, cluster := range c.clusters {
+		for _, b := range cluster.bindings {
+			bindings[b.binding.Name] = true
+		}
+	}
+	return len(bindings)
+}
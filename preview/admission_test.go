@@ -0,0 +1,196 @@
+package preview
+
+import (
+	"strings"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const admissionPolicies = `apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingAdmissionPolicy
+metadata:
+  name: max-replicas
+spec:
+  paramKind:
+    apiVersion: v1
+    kind: ConfigMap
+  matchConstraints:
+    resourceRules:
+    - apiGroups: [apps]
+      apiVersions: [v1]
+      operations: [CREATE, UPDATE]
+      resources: [deployments]
+  variables:
+  - name: maxReplicas
+    expression: int(params.data.maxReplicas)
+  validations:
+  - expression: object.spec.replicas <= variables.maxReplicas
+    messageExpression: "'replicas must be at most ' + string(variables.maxReplicas)"
+---
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingAdmissionPolicyBinding
+metadata:
+  name: max-replicas-prod
+spec:
+  policyName: max-replicas
+  validationActions: [Deny]
+  paramRef:
+    name: replica-limits
+  matchResources:
+    namespaceSelector:
+      matchLabels:
+        env: prod
+---
+apiVersion: admissionregistration.k8s.io/v1beta1
+kind: ValidatingAdmissionPolicy
+metadata:
+  name: team-label
+spec:
+  matchConstraints:
+    resourceRules:
+    - apiGroups: ["*"]
+      apiVersions: ["*"]
+      operations: ["*"]
+      resources: ["*"]
+      scope: Namespaced
+  matchConditions:
+  - name: not-config
+    expression: object.kind != 'ConfigMap'
+  validations:
+  - expression: has(object.metadata.labels) && 'team' in object.metadata.labels
+    message: resources must have a team label
+---
+apiVersion: admissionregistration.k8s.io/v1beta1
+kind: ValidatingAdmissionPolicyBinding
+metadata:
+  name: team-label
+spec:
+  policyName: team-label
+  validationActions: [Warn, Audit]
+`
+
+func TestLoadAdmissionPolicies(t *testing.T) {
+	policies, err := LoadAdmissionPolicies(writePolicy(t, admissionPolicies))
+	require.NoError(t, err)
+	require.Len(t, policies.resources, 4)
+	require.Len(t, policies.policies, 2)
+
+	for _, tc := range []struct{ content, expected string }{
+		{"apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n", "no ValidatingAdmissionPolicy"},
+		{
+			"apiVersion: admissionregistration.k8s.io/v1\nkind: ValidatingAdmissionPolicy\nmetadata:\n  name: a\n" +
+				"spec:\n  validations:\n  - expression: object.(\n",
+			"ValidatingAdmissionPolicy a: invalid expression",
+		},
+	} {
+		_, err := LoadAdmissionPolicies(writePolicy(t, tc.content))
+		require.ErrorContains(t, err, tc.expected, tc.content)
+	}
+}
+
+// TestCheckAdmissionPolicies verifies that the admission policies are evaluated against the resources they are
+// bound to, with the parameters rendered along
+func TestCheckAdmissionPolicies(t *testing.T) {
+	policies, err := LoadAdmissionPolicies(writePolicy(t, admissionPolicies))
+	require.NoError(t, err)
+
+	apps := []argoappv1.Application{newDestinationApp("web", "prod"), newDestinationApp("db", "dev")}
+	rendered := [][]*unstructured.Unstructured{
+		mustParseManifests(t,
+			`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"prod","labels":{"env":"prod"}}}`,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"replica-limits"},"data":{"maxReplicas":"3"}}`,
+			`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","labels":{"team":"a"}},
+			"spec":{"replicas":5}}`,
+		),
+		mustParseManifests(t,
+			`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"db"},"spec":{"replicas":5}}`,
+		),
+	}
+	admission, err := newAdmissionChecker([]*AdmissionPolicies{policies}, apps, rendered)
+	require.NoError(t, err)
+	require.Equal(t, 2, admission.count())
+
+	result, err := checkPolicyRules(nil, admission, apps, rendered, mustCompileFilter(t, ResourceFilter{}))
+	require.NoError(t, err)
+	var violations []string
+	for _, v := range result.violations {
+		violations = append(violations, strings.Join([]string{v.appName, v.resource.GetName(), v.policy, v.severity,
+			v.message}, " | "))
+	}
+	require.Equal(t, []string{
+		"web | web | max-replicas (max-replicas-prod) | error | replicas must be at most 3",
+		"db | db | team-label (team-label) | warning | resources must have a team label",
+	}, violations)
+	require.Equal(t, 2, result.rules)
+}
+
+// TestAdmissionParamNotFound verifies that a missing parameter denies the resources, unless allowed
+func TestAdmissionParamNotFound(t *testing.T) {
+	policies, err := LoadAdmissionPolicies(writePolicy(t, admissionPolicies))
+	require.NoError(t, err)
+	apps := []argoappv1.Application{newDestinationApp("web", "prod")}
+	rendered := [][]*unstructured.Unstructured{
+		mustParseManifests(t,
+			`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"prod","labels":{"env":"prod"}}}`,
+			`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","labels":{"team":"a"}},
+			"spec":{"replicas":1}}`,
+		),
+	}
+
+	admission, err := newAdmissionChecker([]*AdmissionPolicies{policies}, apps, rendered)
+	require.NoError(t, err)
+	violations := admission.check(apps[0], rendered[0][1])
+	require.Len(t, violations, 1)
+	require.Equal(t, "no params found for policy binding with `Deny` parameterNotFoundAction", violations[0].message)
+
+	allowed := strings.Replace(admissionPolicies, "    name: replica-limits\n",
+		"    name: replica-limits\n    parameterNotFoundAction: Allow\n", 1)
+	policies, err = LoadAdmissionPolicies(writePolicy(t, allowed))
+	require.NoError(t, err)
+	admission, err = newAdmissionChecker([]*AdmissionPolicies{policies}, apps, rendered)
+	require.NoError(t, err)
+	require.Empty(t, admission.check(apps[0], rendered[0][1]))
+}
+
+// TestAdmissionPoliciesCompiledOnce verifies that the given policies are compiled once and shared by the
+// destination clusters, while the rendered ones are compiled for the cluster they are rendered to
+func TestAdmissionPoliciesCompiledOnce(t *testing.T) {
+	policies, err := CompileAdmissionPolicies(mustParseManifests(t,
+		`{"apiVersion":"admissionregistration.k8s.io/v1","kind":"ValidatingAdmissionPolicy",
+		"metadata":{"name":"named"},"spec":{"validations":[{"expression":"object.metadata.name != ''"}]}}`,
+		`{"apiVersion":"admissionregistration.k8s.io/v1","kind":"ValidatingAdmissionPolicyBinding",
+		"metadata":{"name":"named"},"spec":{"policyName":"named","validationActions":["Deny"]}}`,
+	))
+	require.NoError(t, err)
+
+	web := newDestinationApp("web", "prod")
+	remote := newDestinationApp("remote", "prod")
+	remote.Spec.Destination.Server = "https://remote.example.com"
+	apps := []argoappv1.Application{web, remote}
+	rendered := [][]*unstructured.Unstructured{
+		mustParseManifests(t, `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings"}}`),
+		mustParseManifests(t,
+			`{"apiVersion":"admissionregistration.k8s.io/v1","kind":"ValidatingAdmissionPolicy",
+			"metadata":{"name":"labelled"},"spec":{"validations":[{"expression":"has(object.metadata.labels)"}]}}`,
+			`{"apiVersion":"admissionregistration.k8s.io/v1","kind":"ValidatingAdmissionPolicyBinding",
+			"metadata":{"name":"labelled"},"spec":{"policyName":"labelled","validationActions":["Warn"]}}`,
+		),
+	}
+	admission, err := newAdmissionChecker([]*AdmissionPolicies{policies}, apps, rendered)
+	require.NoError(t, err)
+
+	local := admission.clusters[inClusterServer]
+	require.Len(t, local.bindings, 1)
+	require.Same(t, policies.policies["named"], local.bindings[0].policy)
+	cluster := admission.clusters[remote.Spec.Destination.Server]
+	require.Len(t, cluster.bindings, 2)
+	require.Same(t, policies.policies["named"], cluster.bindings[0].policy)
+	require.Equal(t, "labelled", cluster.bindings[1].policy.policy.Name)
+	require.NotContains(t, policies.policies, "labelled")
+
+	_, err = CompileAdmissionPolicies(rendered[0])
+	require.EqualError(t, err, "no ValidatingAdmissionPolicy or ValidatingAdmissionPolicyBinding found")
+}
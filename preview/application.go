@@ -1,19 +1,29 @@
 package preview
 
 import (
+	"context"
 	"fmt"
+	"io"
 
-	argocmd "github.com/argoproj/argo-cd/v3/cmd/argocd/commands"
 	cmdutil "github.com/argoproj/argo-cd/v3/cmd/util"
 	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/pflag"
 )
 
-// loadApplications loads Applications from a YAML file
-// Uses ArgoCD's ConstructApps utility function with minimal parameters
-// Returns a value slice for consistency with ApplicationSet's generateApplications
+// loadApplications loads Applications from a YAML file, exiting on failure
 func loadApplications(filename string) []argoappv1.Application {
+	apps, err := LoadApplications(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return apps
+}
+
+// LoadApplications loads Applications from a YAML file
+// Uses ArgoCD's ConstructApps utility function with minimal parameters
+// Returns a value slice for consistency with Renderer.ExpandApplicationSet
+func LoadApplications(filename string) ([]argoappv1.Application, error) {
 	// Create empty FlagSet (required by ConstructApps)
 	flags := pflag.NewFlagSet("", pflag.ContinueOnError)
 
@@ -31,7 +41,7 @@ func loadApplications(filename string) []argoappv1.Application {
 		flags,      // flags - empty flag set
 	)
 	if err != nil {
-		log.Fatal("failed to construct Application: ", err)
+		return nil, fmt.Errorf("failed to construct Application: %w", err)
 	}
 
 	// Convert pointer slice to value slice for consistency with generateApplications pattern
@@ -40,38 +50,48 @@ func loadApplications(filename string) []argoappv1.Application {
 		apps[i] = *app
 	}
 
-	return apps
+	return apps, nil
 }
 
 // PreviewApplication outputs the Application spec(s)
-func PreviewApplication(filename string, appName string, output string) {
+func PreviewApplication(w io.Writer, filename string, appFilter AppFilter, output string) {
 	apps := loadApplications(filename)
+	matcher := appFilter.mustCompile()
 
 	switch output {
-	case "name":
-		printApplicationNames(apps, appName)
-	case "json", "yaml":
-		printApplicationsFormatted(apps, appName, output, filename)
+	case outputFormatName:
+		printApplicationNames(w, apps, matcher)
+	case outputFormatJSON, outputFormatYAML:
+		printApplicationsFormatted(w, apps, matcher, output, filename)
 	default:
-		log.Fatalf("Unknown output format: %s", output)
+		if !isTemplateOutput(output) {
+			log.Fatalf("Unknown output format: %s", output)
+		}
+		if err := printApplicationsTemplated(w, apps, matcher, output); err != nil {
+			log.Fatal(err)
+		}
 	}
 }
 
-// printApplicationNames prints application names to stdout
-func printApplicationNames(apps []argoappv1.Application, appName string) {
-	fmt.Println("NAME")
-	for _, app := range apps {
-		if !shouldMatch(appName) || appName == app.Name {
-			fmt.Printf("application/%s\n", app.Name)
-		}
+// printApplicationNames prints application names
+func printApplicationNames(w io.Writer, apps []argoappv1.Application, matcher *appMatcher) {
+	fmt.Fprintln(w, "NAME")
+	for _, app := range matcher.selectApplications(apps) {
+		fmt.Fprintf(w, "application/%s\n", app.Name)
 	}
 }
 
 // printApplicationsFormatted prints applications in JSON or YAML format
-func printApplicationsFormatted(apps []argoappv1.Application, appName string, output string, filename string) {
-	if !shouldMatch(appName) {
-		// Print all applications
-		if err := argocmd.PrintResourceList(apps, output, false); err != nil {
+func printApplicationsFormatted(
+	w io.Writer,
+	apps []argoappv1.Application,
+	matcher *appMatcher,
+	output string,
+	filename string,
+) {
+	if !shouldMatch(matcher.exactName) {
+		// Print all selected applications
+		if err := printResourceList(w, matcher.selectApplications(apps), output); err != nil {
 			log.Fatal(err)
 		}
 		return
@@ -79,20 +99,43 @@ func printApplicationsFormatted(apps []argoappv1.Application, appName string, ou
 
 	// Filter to specific app
 	for _, app := range apps {
-		if app.Name == appName {
+		if app.Name == matcher.exactName {
 			app.APIVersion = applicationAPIVersion
 			app.Kind = applicationKind
-			if err := argocmd.PrintResource(app, output); err != nil {
+			if err := printResource(w, app, output); err != nil {
 				log.Fatal(err)
 			}
 			return
 		}
 	}
-	log.Fatalf("Application '%s' not found in %s", appName, filename)
+	log.Fatalf("Application '%s' not found in %s", matcher.exactName, filename)
+}
+
+// printApplicationsTemplated prints applications with a jsonpath, go-template or custom-columns template.
+// A single application selected by name is printed as is, otherwise applications are printed as a List.
+func printApplicationsTemplated(w io.Writer, apps []argoappv1.Application, matcher *appMatcher, output string) error {
+	selected := matcher.selectApplications(apps)
+	for i := range selected {
+		selected[i].APIVersion = applicationAPIVersion
+		selected[i].Kind = applicationKind
+	}
+	if shouldMatch(matcher.exactName) && len(selected) == 1 {
+		return printTemplated(w, selected[0], output)
+	}
+	return printTemplatedList(w, selected, output)
 }
 
-// PreviewApplicationResources generates and outputs Kubernetes manifests
-func PreviewApplicationResources(filename string, resKind string, output string) {
+// PreviewApplicationResources generates and outputs Kubernetes manifests, followed by the resources rendered
+// more than once, which are returned
+func PreviewApplicationResources(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	filename string,
+	filter ResourceFilter,
+	order ResourceOrder,
+	output string,
+) []DuplicateResource {
 	apps := loadApplications(filename)
-	generateAndOutputManifests(apps, "", resKind, output)
+	return generateAndOutputManifests(ctx, w, opts, apps, AppFilter{}, filter, order, output)
 }
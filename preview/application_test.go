@@ -1,14 +1,10 @@
 package preview
 
 import (
+	"context"
 	"testing"
 
-	"github.com/argoproj/argo-cd/v3/reposerver/metrics"
-	"github.com/argoproj/argo-cd/v3/reposerver/repository"
-	"github.com/argoproj/argo-cd/v3/util/argo"
-	"github.com/argoproj/argo-cd/v3/util/git"
 	"github.com/stretchr/testify/require"
-	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // TestShouldMatch tests the filtering helper function
@@ -136,31 +132,13 @@ func TestGenerateMultiSourceManifestsWithDifferentRepos(t *testing.T) {
 	require.Equal(t, "https://github.com/argoproj/argocd-example-apps.git", sources[0].RepoURL)
 	require.Equal(t, "https://github.com/different-org/different-repo.git", sources[1].RepoURL)
 
-	// Create a minimal repo service for testing validation logic
+	// Create a minimal renderer for testing validation logic
 	// Note: We're not testing actual manifest generation, just the validation
-	max, err := resource.ParseQuantity("100G")
+	renderer, err := NewRenderer(Options{})
 	require.NoError(t, err)
-	maxValue := max.ToDec().Value()
-	initConstants := repository.RepoServerInitConstants{
-		HelmManifestMaxExtractedSize:      maxValue,
-		HelmRegistryMaxIndexSize:          maxValue,
-		MaxCombinedDirectoryManifestsSize: max,
-		StreamedManifestMaxExtractedSize:  maxValue,
-		StreamedManifestMaxTarSize:        maxValue,
-	}
-
-	repoService := repository.NewService(
-		metrics.NewMetricsServer(),
-		NewNoopCache(),
-		initConstants,
-		argo.NewResourceTracking(),
-		git.NoopCredsStore{},
-		getCacheDir(),
-	)
-	require.NoError(t, repoService.Init())
 
 	// Attempt to generate manifests - should fail with validation error
-	manifests, err := generateMultiSourceManifests(repoService, app)
+	manifests, err := renderer.generateMultiSourceManifests(context.Background(), app)
 	require.Error(t, err, "Should fail when Git sources use different repositories")
 	require.Nil(t, manifests, "Should not return manifests on validation error")
 	require.Contains(
@@ -187,30 +165,12 @@ func TestGenerateMultiSourceManifestsWithEmptyRepoURL(t *testing.T) {
 	require.NotEmpty(t, sources[0].RepoURL, "First source should have repoURL")
 	require.Empty(t, sources[1].RepoURL, "Second source should have empty repoURL")
 
-	// Create minimal repo service for testing
-	max, err := resource.ParseQuantity("100G")
+	// Create minimal renderer for testing
+	renderer, err := NewRenderer(Options{})
 	require.NoError(t, err)
-	maxValue := max.ToDec().Value()
-	initConstants := repository.RepoServerInitConstants{
-		HelmManifestMaxExtractedSize:      maxValue,
-		HelmRegistryMaxIndexSize:          maxValue,
-		MaxCombinedDirectoryManifestsSize: max,
-		StreamedManifestMaxExtractedSize:  maxValue,
-		StreamedManifestMaxTarSize:        maxValue,
-	}
-
-	repoService := repository.NewService(
-		metrics.NewMetricsServer(),
-		NewNoopCache(),
-		initConstants,
-		argo.NewResourceTracking(),
-		git.NoopCredsStore{},
-		getCacheDir(),
-	)
-	require.NoError(t, repoService.Init())
 
 	// Attempt to generate manifests - should fail with validation error
-	manifests, err := generateMultiSourceManifests(repoService, app)
+	manifests, err := renderer.generateMultiSourceManifests(context.Background(), app)
 	require.Error(t, err, "Should fail when source has empty repoURL")
 	require.Nil(t, manifests, "Should not return manifests on validation error")
 	require.Contains(t, err.Error(), "empty repoURL", "Error should mention empty repoURL")
@@ -1,13 +1,12 @@
 package preview
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
 
-	appsettemplate "github.com/argoproj/argo-cd/v3/applicationset/controllers/template"
 	"github.com/argoproj/argo-cd/v3/applicationset/generators"
-	appsetutils "github.com/argoproj/argo-cd/v3/applicationset/utils"
-	argocmd "github.com/argoproj/argo-cd/v3/cmd/argocd/commands"
 	cmdutil "github.com/argoproj/argo-cd/v3/cmd/util"
 	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
 	"github.com/argoproj/pkg/errors"
@@ -38,42 +37,44 @@ func initConfig() {
 	logger.SetLevel(log.WarnLevel)
 }
 
-func PreviewApplications(filename string, appName string, output string) {
-	apps := generateApplications(filename)
+func PreviewApplications(ctx context.Context, w io.Writer, filename string, appFilter AppFilter, output string) {
+	matcher := appFilter.mustCompile()
+	apps := generateApplications(ctx, filename)
 	switch output {
 	case outputFormatName:
-		printAppSetNames(apps, appName)
+		printAppSetNames(w, apps, matcher)
 	case outputFormatJSON, outputFormatYAML:
-		printAppSetFormatted(apps, appName, output)
+		printAppSetFormatted(w, apps, matcher, output)
 	default:
-		errors.CheckError(fmt.Errorf("unknown output format: %s", output))
+		if !isTemplateOutput(output) {
+			errors.CheckError(fmt.Errorf("unknown output format: %s", output))
+		}
+		errors.CheckError(printApplicationsTemplated(w, apps, matcher, output))
 	}
 }
 
-// printAppSetNames prints application names from ApplicationSet to stdout
-func printAppSetNames(apps []argoappv1.Application, appName string) {
-	fmt.Println("NAME")
-	for _, app := range apps {
-		if !shouldMatch(appName) || appName == app.Name {
-			fmt.Printf("application/%s\n", app.Name)
-		}
+// printAppSetNames prints application names from ApplicationSet
+func printAppSetNames(w io.Writer, apps []argoappv1.Application, matcher *appMatcher) {
+	fmt.Fprintln(w, "NAME")
+	for _, app := range matcher.selectApplications(apps) {
+		fmt.Fprintf(w, "application/%s\n", app.Name)
 	}
 }
 
 // printAppSetFormatted prints applications from ApplicationSet in JSON or YAML format
-func printAppSetFormatted(apps []argoappv1.Application, appName string, output string) {
-	if !shouldMatch(appName) {
-		if err := argocmd.PrintResourceList(apps, output, false); err != nil {
+func printAppSetFormatted(w io.Writer, apps []argoappv1.Application, matcher *appMatcher, output string) {
+	if !shouldMatch(matcher.exactName) {
+		if err := printResourceList(w, matcher.selectApplications(apps), output); err != nil {
 			log.Fatal(err)
 		}
 		return
 	}
 
 	for _, app := range apps {
-		if appName == app.Name {
+		if matcher.exactName == app.Name {
 			app.APIVersion = applicationAPIVersion
 			app.Kind = applicationKind
-			if err := argocmd.PrintResource(app, output); err != nil {
+			if err := printResource(w, app, output); err != nil {
 				log.Fatal(err)
 			}
 			return
@@ -81,34 +82,50 @@ func printAppSetFormatted(apps []argoappv1.Application, appName string, output s
 	}
 }
 
-func PreviewResources(filename string, appName string, resKind string, output string) {
-	apps := generateApplications(filename)
-	generateAndOutputManifests(apps, appName, resKind, output)
+// PreviewResources generates and outputs the Kubernetes manifests of the Applications of an ApplicationSet,
+// followed by the resources rendered more than once, which are returned
+func PreviewResources(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	filename string,
+	appFilter AppFilter,
+	filter ResourceFilter,
+	order ResourceOrder,
+	output string,
+) []DuplicateResource {
+	apps := generateApplications(ctx, filename)
+	return generateAndOutputManifests(ctx, w, opts, apps, appFilter, filter, order, output)
 }
 
-func generateApplications(filename string) []argoappv1.Application {
-	appSets, err := cmdutil.ConstructApplicationSet(filename)
+// generateApplications generates the Applications of the first ApplicationSet in a YAML file, exiting on failure
+func generateApplications(ctx context.Context, filename string) []argoappv1.Application {
+	appSets, err := LoadApplicationSets(filename)
 	if err != nil {
-		log.Fatal("failed to construct ApplicationSet: ", err)
+		log.Fatal(err)
 	}
 	if len(appSets) > 1 {
 		log.Warnf("found %d ApplicationSets, only previewing the first entry", len(appSets))
 	}
-	appSet := appSets[0]
-	appSetGenerators := getAppSetGenerators()
-	apps, _, err := appsettemplate.GenerateApplications(
-		log.NewEntry(logger),
-		*appSet,
-		appSetGenerators,
-		&appsetutils.Render{},
-		nil,
-	)
+	apps, err := ExpandApplicationSet(ctx, appSets[0])
 	if err != nil {
-		log.Fatal("failed to generate Application(s): ", err)
+		log.Fatal(err)
 	}
 	return apps
 }
 
+// LoadApplicationSets loads ApplicationSets from a YAML file
+func LoadApplicationSets(filename string) ([]*argoappv1.ApplicationSet, error) {
+	appSets, err := cmdutil.ConstructApplicationSet(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct ApplicationSet: %w", err)
+	}
+	if len(appSets) == 0 {
+		return nil, fmt.Errorf("no ApplicationSet found in %s", filename)
+	}
+	return appSets, nil
+}
+
 func getAppSetGenerators() map[string]generators.Generator {
 	terminalGenerators := map[string]generators.Generator{
 		"List": generators.NewListGenerator(),
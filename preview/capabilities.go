@@ -0,0 +1,123 @@
+package preview
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// Capabilities are the Kubernetes version and API versions of a cluster, which the Argo CD server passes to Helm
+// (.Capabilities.KubeVersion and .Capabilities.APIVersions) and to Kustomize when rendering Helm charts
+type Capabilities struct {
+	// KubeVersion is the Kubernetes version, e.g. 1.30 or v1.30.2. Empty means the Helm default.
+	KubeVersion string
+	// APIVersions are the available API versions, as group/version or group/version/Kind.
+	// Nil means the Helm defaults.
+	APIVersions []string
+}
+
+// validate returns an error if the Kubernetes version cannot be parsed
+func (c Capabilities) validate() error {
+	if c.KubeVersion == "" {
+		return nil
+	}
+	if _, err := version.ParseGeneric(c.KubeVersion); err != nil {
+		return fmt.Errorf("invalid Kubernetes version '%s': %w", c.KubeVersion, err)
+	}
+	return nil
+}
+
+// merge returns the capabilities, completed with the given defaults for the ones that are not set
+func (c Capabilities) merge(defaults Capabilities) Capabilities {
+	if c.KubeVersion == "" {
+		c.KubeVersion = defaults.KubeVersion
+	}
+	if c.APIVersions == nil {
+		c.APIVersions = defaults.APIVersions
+	}
+	return c
+}
+
+// LoadAPIVersions reads the API versions of a cluster from a file, either the output of kubectl api-versions,
+// one group/version per line, or the output of kubectl api-resources, from which both the group/version and
+// group/version/Kind of each resource are listed, the way the Argo CD server does.
+func LoadAPIVersions(filename string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API versions %s: %w", filename, err)
+	}
+
+	apiVersions := map[string]bool{}
+	apiVersionColumn, kindColumn := -1, -1
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] == "NAME" {
+			// kubectl api-resources header: the columns are aligned, and the short names may be empty
+			apiVersionColumn, kindColumn = strings.Index(line, "APIVERSION"), strings.Index(line, "KIND")
+			if apiVersionColumn < 0 || kindColumn < 0 {
+				return nil, fmt.Errorf("invalid API resources %s: missing APIVERSION or KIND column", filename)
+			}
+			continue
+		}
+		if apiVersionColumn < 0 {
+			apiVersions[fields[0]] = true
+			continue
+		}
+		groupVersion, kind := columnValue(line, apiVersionColumn), columnValue(line, kindColumn)
+		if _, err := schema.ParseGroupVersion(groupVersion); err != nil || groupVersion == "" || kind == "" {
+			return nil, fmt.Errorf("invalid API resources %s: unexpected line '%s'", filename, line)
+		}
+		apiVersions[groupVersion] = true
+		apiVersions[groupVersion+"/"+kind] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read API versions %s: %w", filename, err)
+	}
+
+	result := make([]string, 0, len(apiVersions))
+	for apiVersion := range apiVersions {
+		result = append(result, apiVersion)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// columnValue returns the value of the column of an aligned table line starting at the given offset
+func columnValue(line string, offset int) string {
+	if offset >= len(line) {
+		return ""
+	}
+	fields := strings.Fields(line[offset:])
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// capabilities returns the capabilities of the destination cluster of an Application, looked up by URL and then
+// by name, falling back to the default capabilities
+func (r *Renderer) capabilities(app argoappv1.Application) Capabilities {
+	destination := destinationOf(app)
+	for _, key := range []string{destination.Server, destination.Name} {
+		if key == "" {
+			continue
+		}
+		if capabilities, ok := r.opts.ClusterCapabilities[key]; ok {
+			return capabilities.merge(r.opts.Capabilities)
+		}
+	}
+	return r.opts.Capabilities
+}
@@ -0,0 +1,82 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+// writeAPIVersions writes an API versions file to a temporary file
+func writeAPIVersions(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "api-versions.txt")
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0o600))
+	return filename
+}
+
+func TestLoadAPIVersions(t *testing.T) {
+	apiVersions, err := LoadAPIVersions(writeAPIVersions(t, "v1\napps/v1\n\nmonitoring.coreos.com/v1\napps/v1\n"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"apps/v1", "monitoring.coreos.com/v1", "v1"}, apiVersions)
+
+	_, err = LoadAPIVersions(filepath.Join(t.TempDir(), "missing.txt"))
+	require.ErrorContains(t, err, "failed to read API versions")
+}
+
+// TestLoadAPIResources verifies that the output of kubectl api-resources lists the kinds along with their
+// group/version, including the resources without short names
+func TestLoadAPIResources(t *testing.T) {
+	apiResources := `NAME              SHORTNAMES   APIVERSION                NAMESPACED   KIND
+configmaps        cm           v1                        true         ConfigMap
+deployments       deploy       apps/v1                   true         Deployment
+servicemonitors                monitoring.coreos.com/v1  true         ServiceMonitor
+`
+	apiVersions, err := LoadAPIVersions(writeAPIVersions(t, apiResources))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"apps/v1", "apps/v1/Deployment",
+		"monitoring.coreos.com/v1", "monitoring.coreos.com/v1/ServiceMonitor",
+		"v1", "v1/ConfigMap",
+	}, apiVersions)
+
+	_, err = LoadAPIVersions(writeAPIVersions(t, "NAME   SHORTNAMES\nconfigmaps   cm\n"))
+	require.ErrorContains(t, err, "missing APIVERSION or KIND column")
+}
+
+// TestRendererCapabilities verifies that the capabilities of the destination cluster are passed to the repo service
+func TestRendererCapabilities(t *testing.T) {
+	_, err := NewRenderer(Options{Capabilities: Capabilities{KubeVersion: "latest"}})
+	require.ErrorContains(t, err, "invalid Kubernetes version 'latest'")
+	_, err = NewRenderer(Options{ClusterCapabilities: map[string]Capabilities{"prod": {KubeVersion: "x"}}})
+	require.ErrorContains(t, err, "cluster prod: invalid Kubernetes version 'x'")
+
+	renderer := newTestRenderer(t, Options{
+		Capabilities: Capabilities{KubeVersion: "1.30", APIVersions: []string{"v1", "apps/v1"}},
+		ClusterCapabilities: map[string]Capabilities{
+			"https://prod.example.com": {KubeVersion: "v1.29.4"},
+			"in-cluster":               {APIVersions: []string{"v1"}},
+		},
+	})
+	source := &argoappv1.ApplicationSource{RepoURL: "https://example.com/repo.git", Path: "web"}
+	request := func(destination argoappv1.ApplicationDestination) (string, []string) {
+		app := argoappv1.Application{Spec: argoappv1.ApplicationSpec{Destination: destination}}
+		request, err := renderer.manifestRequest(app, source, &argoappv1.Repository{Repo: source.RepoURL})
+		require.NoError(t, err)
+		return request.KubeVersion, request.ApiVersions
+	}
+
+	kubeVersion, apiVersions := request(argoappv1.ApplicationDestination{Server: "https://staging.example.com"})
+	require.Equal(t, "1.30", kubeVersion)
+	require.Equal(t, []string{"v1", "apps/v1"}, apiVersions)
+
+	kubeVersion, apiVersions = request(argoappv1.ApplicationDestination{Server: "https://prod.example.com"})
+	require.Equal(t, "v1.29.4", kubeVersion)
+	require.Equal(t, []string{"v1", "apps/v1"}, apiVersions)
+
+	kubeVersion, apiVersions = request(argoappv1.ApplicationDestination{Server: inClusterServer})
+	require.Equal(t, "1.30", kubeVersion)
+	require.Equal(t, []string{"v1"}, apiVersions)
+}
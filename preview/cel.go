@@ -0,0 +1,81 @@
+package preview
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/apiserver/pkg/cel/environment"
+)
+
+// newCELEnv returns a CEL environment with the Kubernetes libraries available to ValidatingAdmissionPolicies,
+// declaring the given variables as dynamically typed
+func newCELEnv(variables ...string) (*cel.Env, error) {
+	opts := make([]cel.EnvOption, 0, len(variables))
+	for _, variable := range variables {
+		opts = append(opts, cel.Variable(variable, cel.DynType))
+	}
+	// The libraries of the stored expressions environment are all those the API server may evaluate
+	envSet, err := environment.MustBaseEnvSet(environment.DefaultCompatibilityVersion(), true).Extend(
+		environment.VersionedOptions{IntroducedVersion: version.MajorMinor(1, 0), EnvOptions: opts},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return envSet.Env(environment.StoredExpressions)
+}
+
+// compileCEL compiles an expression that must evaluate to the given type
+func compileCEL(env *cel.Env, expression string, outputType *cel.Type) (cel.Program, error) {
+	ast, issues := env.Compile(expression)
+	if issues.Err() != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", expression, issues.Err())
+	}
+	if !outputType.IsAssignableType(ast.OutputType()) {
+		return nil, fmt.Errorf("expression %q must evaluate to a %s, not a %s", expression, outputType, ast.OutputType())
+	}
+	return env.Program(ast)
+}
+
+// evalBool evaluates a compiled expression that must evaluate to a bool
+func evalBool(program cel.Program, vars map[string]any) (bool, error) {
+	out, _, err := program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("expression evaluated to a %s, not a bool", out.Type().TypeName())
+	}
+	return result, nil
+}
+
+// evalString evaluates a compiled expression that must evaluate to a string
+func evalString(program cel.Program, vars map[string]any) (string, error) {
+	out, _, err := program.Eval(vars)
+	if err != nil {
+		return "", err
+	}
+	result, ok := out.Value().(string)
+	if !ok {
+		return "", fmt.Errorf("expression evaluated to a %s, not a string", out.Type().TypeName())
+	}
+	return result, nil
+}
+
+// failureMessage returns the message of a failed validation: the result of its message expression if any,
+// or else its message, or else the failed expression, the way the API server reports ValidatingAdmissionPolicy
+// failures
+func failureMessage(messageExpression cel.Program, message string, expression string, vars map[string]any) string {
+	if messageExpression != nil {
+		result, err := evalString(messageExpression, vars)
+		if err == nil && strings.TrimSpace(result) != "" {
+			return result
+		}
+	}
+	if message != "" {
+		return message
+	}
+	return "failed expression: " + expression
+}
@@ -0,0 +1,264 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	errorsutil "github.com/argoproj/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// deprecatedAPI is an API version of a kind that is deprecated, and possibly removed, from a Kubernetes version
+type deprecatedAPI struct {
+	apiVersion  string
+	kind        string
+	deprecated  string
+	removed     string
+	replacement string
+}
+
+// deprecatedAPIs are the deprecated API versions of the built-in kinds, as listed in the Kubernetes
+// deprecated API migration guide
+var deprecatedAPIs = []deprecatedAPI{
+	{"extensions/v1beta1", "DaemonSet", "1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "Deployment", "1.9", "1.16", "apps/v1"},
+	{"extensions/v1beta1", "NetworkPolicy", "1.9", "1.16", "networking.k8s.io/v1"},
+	{"extensions/v1beta1", "PodSecurityPolicy", "1.10", "1.16", "policy/v1beta1"},
+	{"extensions/v1beta1", "ReplicaSet", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta1", "Deployment", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta1", "ReplicaSet", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta1", "StatefulSet", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "DaemonSet", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "Deployment", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "ReplicaSet", "1.9", "1.16", "apps/v1"},
+	{"apps/v1beta2", "StatefulSet", "1.9", "1.16", "apps/v1"},
+
+	{"admissionregistration.k8s.io/v1beta1", "MutatingWebhookConfiguration", "1.16", "1.22",
+		"admissionregistration.k8s.io/v1"},
+	{"admissionregistration.k8s.io/v1beta1", "ValidatingWebhookConfiguration", "1.16", "1.22",
+		"admissionregistration.k8s.io/v1"},
+	{"apiextensions.k8s.io/v1beta1", "CustomResourceDefinition", "1.16", "1.22", "apiextensions.k8s.io/v1"},
+	{"apiregistration.k8s.io/v1beta1", "APIService", "1.19", "1.22", "apiregistration.k8s.io/v1"},
+	{"authentication.k8s.io/v1beta1", "TokenReview", "1.19", "1.22", "authentication.k8s.io/v1"},
+	{"authorization.k8s.io/v1beta1", "LocalSubjectAccessReview", "1.19", "1.22", "authorization.k8s.io/v1"},
+	{"authorization.k8s.io/v1beta1", "SelfSubjectAccessReview", "1.19", "1.22", "authorization.k8s.io/v1"},
+	{"authorization.k8s.io/v1beta1", "SubjectAccessReview", "1.19", "1.22", "authorization.k8s.io/v1"},
+	{"certificates.k8s.io/v1beta1", "CertificateSigningRequest", "1.19", "1.22", "certificates.k8s.io/v1"},
+	{"coordination.k8s.io/v1beta1", "Lease", "1.19", "1.22", "coordination.k8s.io/v1"},
+	{"extensions/v1beta1", "Ingress", "1.14", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "Ingress", "1.19", "1.22", "networking.k8s.io/v1"},
+	{"networking.k8s.io/v1beta1", "IngressClass", "1.19", "1.22", "networking.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRole", "1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "ClusterRoleBinding", "1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "Role", "1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"rbac.authorization.k8s.io/v1beta1", "RoleBinding", "1.17", "1.22", "rbac.authorization.k8s.io/v1"},
+	{"scheduling.k8s.io/v1beta1", "PriorityClass", "1.14", "1.22", "scheduling.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSIDriver", "1.19", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "CSINode", "1.17", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "StorageClass", "1.19", "1.22", "storage.k8s.io/v1"},
+	{"storage.k8s.io/v1beta1", "VolumeAttachment", "1.19", "1.22", "storage.k8s.io/v1"},
+
+	{"autoscaling/v2beta1", "HorizontalPodAutoscaler", "1.22", "1.25", "autoscaling/v2"},
+	{"batch/v1beta1", "CronJob", "1.21", "1.25", "batch/v1"},
+	{"discovery.k8s.io/v1beta1", "EndpointSlice", "1.21", "1.25", "discovery.k8s.io/v1"},
+	{"events.k8s.io/v1beta1", "Event", "1.19", "1.25", "events.k8s.io/v1"},
+	{"node.k8s.io/v1beta1", "RuntimeClass", "1.20", "1.25", "node.k8s.io/v1"},
+	{"policy/v1beta1", "PodDisruptionBudget", "1.21", "1.25", "policy/v1"},
+	{"policy/v1beta1", "PodSecurityPolicy", "1.21", "1.25", "none, use Pod Security Admission"},
+
+	{"autoscaling/v2beta2", "HorizontalPodAutoscaler", "1.23", "1.26", "autoscaling/v2"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "FlowSchema", "1.23", "1.26", "flowcontrol.apiserver.k8s.io/v1beta3"},
+	{"flowcontrol.apiserver.k8s.io/v1beta1", "PriorityLevelConfiguration", "1.23", "1.26",
+		"flowcontrol.apiserver.k8s.io/v1beta3"},
+	{"storage.k8s.io/v1beta1", "CSIStorageCapacity", "1.24", "1.27", "storage.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "FlowSchema", "1.26", "1.29", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta2", "PriorityLevelConfiguration", "1.26", "1.29",
+		"flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "FlowSchema", "1.29", "1.32", "flowcontrol.apiserver.k8s.io/v1"},
+	{"flowcontrol.apiserver.k8s.io/v1beta3", "PriorityLevelConfiguration", "1.29", "1.32",
+		"flowcontrol.apiserver.k8s.io/v1"},
+
+	{"v1", "ComponentStatus", "1.19", "", "none"},
+	{"v1", "Endpoints", "1.33", "", "discovery.k8s.io/v1 EndpointSlice"},
+}
+
+// findDeprecatedAPI returns the deprecation of the API version of a resource, or nil if it is not deprecated
+func findDeprecatedAPI(resource *unstructured.Unstructured) *deprecatedAPI {
+	for i, api := range deprecatedAPIs {
+		if api.apiVersion == resource.GetAPIVersion() && api.kind == resource.GetKind() {
+			return &deprecatedAPIs[i]
+		}
+	}
+	return nil
+}
+
+// isRemoved returns true if the API version is removed from the Kubernetes version
+func (api *deprecatedAPI) isRemoved(target *version.Version) bool {
+	return api.removed != "" && target.AtLeast(version.MustParseGeneric(api.removed))
+}
+
+// isDeprecated returns true if the API version is deprecated in the Kubernetes version
+func (api *deprecatedAPI) isDeprecated(target *version.Version) bool {
+	return target.AtLeast(version.MustParseGeneric(api.deprecated))
+}
+
+// status describes when the API version is deprecated and removed
+func (api *deprecatedAPI) status(target *version.Version) string {
+	if api.isRemoved(target) {
+		return "removed in " + api.removed
+	}
+	if api.removed != "" {
+		return fmt.Sprintf("deprecated in %s, removed in %s", api.deprecated, api.removed)
+	}
+	return "deprecated in " + api.deprecated
+}
+
+// deprecatedResource is a rendered resource using a deprecated API version
+type deprecatedResource struct {
+	appName  string
+	resource *unstructured.Unstructured
+	api      *deprecatedAPI
+	target   *version.Version
+}
+
+// deprecationResult holds the rendered resources using deprecated API versions
+type deprecationResult struct {
+	resources []deprecatedResource
+	// checked counts the resources checked, removed and deprecated those using removed and deprecated API versions
+	checked, removed, deprecated int
+}
+
+// CheckApplicationAPIs renders an Application manifest and reports the resources using API versions deprecated
+// or removed in the target Kubernetes version, returning false if any of them uses a removed API version.
+// An empty target version means the Kubernetes version of the destination cluster in the Options Capabilities.
+func CheckApplicationAPIs(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	targetVersion string,
+	filename string,
+	filter ResourceFilter,
+) bool {
+	return generateAndCheckAPIs(ctx, w, opts, targetVersion, filename, loadApplicationsFile, AppFilter{}, filter)
+}
+
+// CheckAPIs renders an ApplicationSet manifest and reports the resources using API versions deprecated
+// or removed in the target Kubernetes version, returning false if any of them uses a removed API version.
+// An empty target version means the Kubernetes version of the destination cluster in the Options Capabilities.
+func CheckAPIs(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	targetVersion string,
+	filename string,
+	appFilter AppFilter,
+	filter ResourceFilter,
+) bool {
+	return generateAndCheckAPIs(ctx, w, opts, targetVersion, filename, expandApplicationSetFile, appFilter, filter)
+}
+
+// generateAndCheckAPIs renders the Applications of a manifest file and outputs their resources using
+// deprecated API versions
+func generateAndCheckAPIs(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	targetVersion string,
+	filename string,
+	load applicationsLoader,
+	appFilter AppFilter,
+	filter ResourceFilter,
+) bool {
+	appsMatcher := appFilter.mustCompile()
+	matcher := filter.mustCompile()
+	if targetVersion != "" {
+		if _, err := version.ParseGeneric(targetVersion); err != nil {
+			errorsutil.CheckError(fmt.Errorf("invalid target Kubernetes version %s: %w", targetVersion, err))
+		}
+	}
+
+	renderer, err := NewRenderer(opts)
+	errorsutil.CheckError(err)
+	defer renderer.Close()
+	apps, err := load(ctx, renderer, filename)
+	errorsutil.CheckError(err)
+	selected := appsMatcher.selectApplications(apps)
+	targets := make([]*version.Version, len(selected))
+	for i, app := range selected {
+		targets[i], err = renderer.targetKubeVersion(app, targetVersion)
+		errorsutil.CheckError(err)
+	}
+	rendered, err := renderer.RenderApplications(ctx, selected)
+	errorsutil.CheckError(err)
+
+	result := checkDeprecatedAPIs(selected, targets, rendered, matcher)
+	errorsutil.CheckError(printDeprecationResult(w, result))
+	return result.removed == 0
+}
+
+// targetKubeVersion returns the Kubernetes version the resources of an Application are checked against:
+// the target version if any, or else the Kubernetes version of its destination cluster
+func (r *Renderer) targetKubeVersion(app argoappv1.Application, targetVersion string) (*version.Version, error) {
+	if targetVersion == "" {
+		targetVersion = r.capabilities(app).KubeVersion
+	}
+	if targetVersion == "" {
+		return nil, fmt.Errorf("no target Kubernetes version for application '%s'", app.Name)
+	}
+	return version.ParseGeneric(targetVersion)
+}
+
+// checkDeprecatedAPIs returns the resources of each Application selected by the matcher that use an API
+// version deprecated in the target Kubernetes version of the Application
+func checkDeprecatedAPIs(
+	apps []argoappv1.Application,
+	targets []*version.Version,
+	rendered [][]*unstructured.Unstructured,
+	matcher *resourceMatcher,
+) deprecationResult {
+	var result deprecationResult
+	for i, resources := range rendered {
+		resources = selectResources(resources, matcher)
+		sortResources(resources, OrderName)
+		for _, resource := range resources {
+			result.checked++
+			api := findDeprecatedAPI(resource)
+			if api == nil || !api.isDeprecated(targets[i]) {
+				continue
+			}
+			if api.isRemoved(targets[i]) {
+				result.removed++
+			} else {
+				result.deprecated++
+			}
+			result.resources = append(result.resources,
+				deprecatedResource{appName: apps[i].Name, resource: resource, api: api, target: targets[i]})
+		}
+	}
+	return result
+}
+
+// printDeprecationResult prints the resources using deprecated API versions as a table, followed by a summary
+func printDeprecationResult(w io.Writer, result deprecationResult) error {
+	if len(result.resources) > 0 {
+		tw := newTableWriter(w)
+		fmt.Fprintln(tw, "APP\tKIND\tNAMESPACE\tNAME\tAPI VERSION\tSTATUS\tREPLACEMENT")
+		for _, r := range result.resources {
+			fmt.Fprintln(tw, strings.Join([]string{
+				r.appName, r.resource.GetKind(), r.resource.GetNamespace(), r.resource.GetName(),
+				r.resource.GetAPIVersion(), r.api.status(r.target), r.api.replacement,
+			}, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	_, err := fmt.Fprintf(w, "%d resource(s) checked, %d using removed APIs, %d using deprecated APIs\n",
+		result.checked, result.removed, result.deprecated)
+	return err
+}
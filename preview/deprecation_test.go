@@ -0,0 +1,94 @@
+package preview
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// TestDeprecatedAPIs verifies that the deprecated API versions are reported according to the target version
+func TestDeprecatedAPIs(t *testing.T) {
+	for _, api := range deprecatedAPIs {
+		deprecated := version.MustParseGeneric(api.deprecated)
+		if api.removed != "" {
+			require.True(t, version.MustParseGeneric(api.removed).GreaterThan(deprecated), api.apiVersion+" "+api.kind)
+		}
+	}
+
+	resources := mustParseManifests(t,
+		`{"apiVersion":"policy/v1beta1","kind":"PodSecurityPolicy","metadata":{"name":"restricted"}}`,
+		`{"apiVersion":"policy/v1","kind":"PodDisruptionBudget","metadata":{"name":"web"}}`,
+	)
+	api := findDeprecatedAPI(resources[0])
+	require.NotNil(t, api)
+	require.Nil(t, findDeprecatedAPI(resources[1]))
+
+	require.False(t, api.isDeprecated(version.MustParseGeneric("1.20")))
+	require.True(t, api.isDeprecated(version.MustParseGeneric("1.21")))
+	require.False(t, api.isRemoved(version.MustParseGeneric("1.24.3")))
+	require.Equal(t, "deprecated in 1.21, removed in 1.25", api.status(version.MustParseGeneric("1.24")))
+	require.True(t, api.isRemoved(version.MustParseGeneric("1.25")))
+	require.Equal(t, "removed in 1.25", api.status(version.MustParseGeneric("1.30")))
+}
+
+// TestCheckDeprecatedAPIs verifies that the resources are checked against the target version of their Application
+func TestCheckDeprecatedAPIs(t *testing.T) {
+	apps := []argoappv1.Application{
+		{ObjectMeta: metav1.ObjectMeta{Name: "old"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "new"}},
+	}
+	manifests := []string{
+		`{"apiVersion":"batch/v1beta1","kind":"CronJob","metadata":{"name":"backup","namespace":"prod"}}`,
+		`{"apiVersion":"autoscaling/v2beta2","kind":"HorizontalPodAutoscaler","metadata":{"name":"web"}}`,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web"}}`,
+	}
+	rendered := [][]*unstructured.Unstructured{mustParseManifests(t, manifests...), mustParseManifests(t, manifests...)}
+	targets := []*version.Version{version.MustParseGeneric("1.22"), version.MustParseGeneric("1.25")}
+
+	result := checkDeprecatedAPIs(apps, targets, rendered, mustCompileFilter(t, ResourceFilter{}))
+	require.Equal(t, 6, result.checked)
+	require.Equal(t, 1, result.removed)
+	require.Equal(t, 2, result.deprecated)
+	var statuses []string
+	for _, r := range result.resources {
+		statuses = append(statuses, r.appName+" "+r.resource.GetKind()+": "+r.api.status(r.target))
+	}
+	require.Equal(t, []string{
+		"old CronJob: deprecated in 1.21, removed in 1.25",
+		"new CronJob: removed in 1.25",
+		"new HorizontalPodAutoscaler: deprecated in 1.23, removed in 1.26",
+	}, statuses)
+
+	var buf bytes.Buffer
+	require.NoError(t, printDeprecationResult(&buf, result))
+	require.Contains(t, buf.String(), "APP   KIND                      NAMESPACE   NAME     API VERSION           STATUS")
+	require.Contains(t, buf.String(), "batch/v1beta1         removed in 1.25                       batch/v1\n")
+	require.True(t, strings.HasSuffix(buf.String(),
+		"\n\n6 resource(s) checked, 1 using removed APIs, 2 using deprecated APIs\n"))
+}
+
+// TestTargetKubeVersion verifies that the target version defaults to the Kubernetes version of the cluster
+func TestTargetKubeVersion(t *testing.T) {
+	renderer := newTestRenderer(t, Options{
+		ClusterCapabilities: map[string]Capabilities{"https://prod.example.com": {KubeVersion: "1.29"}},
+	})
+	app := argoappv1.Application{ObjectMeta: metav1.ObjectMeta{Name: "web"}}
+
+	target, err := renderer.targetKubeVersion(app, "1.25")
+	require.NoError(t, err)
+	require.Equal(t, "1.25", target.String())
+
+	_, err = renderer.targetKubeVersion(app, "")
+	require.EqualError(t, err, "no target Kubernetes version for application 'web'")
+
+	app.Spec.Destination.Server = "https://prod.example.com"
+	target, err = renderer.targetKubeVersion(app, "")
+	require.NoError(t, err)
+	require.Equal(t, "1.29", target.String())
+}
@@ -0,0 +1,383 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	"github.com/argoproj/pkg/errors"
+	"github.com/pmezard/go-difflib/difflib"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// ChangeType describes how a resource or an Application differs between two renders
+type ChangeType string
+
+const (
+	ChangeAdded    ChangeType = "added"
+	ChangeRemoved  ChangeType = "removed"
+	ChangeModified ChangeType = "modified"
+)
+
+// ResourceDiff is the difference of a single resource between two renders
+type ResourceDiff struct {
+	Key    kube.ResourceKey
+	Change ChangeType
+	// Diff is the unified diff of the YAML representation of the resource
+	Diff string
+	// IgnoreExtraneous is set on a resource requiring pruning whose IgnoreExtraneous compare option
+	// keeps it from making its Application OutOfSync
+	IgnoreExtraneous bool
+	// PruneDisabled is set on a resource requiring pruning that Argo CD does not prune, due to its
+	// Prune=false sync option
+	PruneDisabled bool
+}
+
+// ApplicationDiff holds the resource differences of an Application between two renders
+type ApplicationDiff struct {
+	Name      string
+	Change    ChangeType
+	Resources []ResourceDiff
+}
+
+// applicationsLoader loads the Applications defined in a manifest file
+type applicationsLoader func(ctx context.Context, renderer *Renderer, filename string) ([]argoappv1.Application, error)
+
+// loadApplicationsFile loads the Applications of an Application manifest file
+func loadApplicationsFile(_ context.Context, _ *Renderer, filename string) ([]argoappv1.Application, error) {
+	return LoadApplications(filename)
+}
+
+// expandApplicationSetFile generates the Applications of the first ApplicationSet of a manifest file
+func expandApplicationSetFile(
+	ctx context.Context,
+	renderer *Renderer,
+	filename string,
+) ([]argoappv1.Application, error) {
+	appSets, err := LoadApplicationSets(filename)
+	if err != nil {
+		return nil, err
+	}
+	return renderer.ExpandApplicationSet(ctx, appSets[0])
+}
+
+// PreviewApplicationDiff renders an Application manifest at two revisions and outputs the differences, followed
+// by the resources rendered more than once at the head revision, which are returned
+func PreviewApplicationDiff(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	filename string,
+	base string,
+	head string,
+	filter ResourceFilter,
+	output string,
+	maxDiffLines int,
+) []DuplicateResource {
+	return generateAndOutputDiff(
+		ctx, w, opts, filename, loadApplicationsFile, base, head, AppFilter{}, filter, output, maxDiffLines)
+}
+
+// PreviewDiff renders an ApplicationSet manifest at two revisions and outputs the differences, followed
+// by the resources rendered more than once at the head revision, which are returned
+func PreviewDiff(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	filename string,
+	base string,
+	head string,
+	appFilter AppFilter,
+	filter ResourceFilter,
+	output string,
+	maxDiffLines int,
+) []DuplicateResource {
+	return generateAndOutputDiff(
+		ctx, w, opts, filename, expandApplicationSetFile, base, head, appFilter, filter, output, maxDiffLines)
+}
+
+// generateAndOutputDiff renders the Applications of a manifest file at the base and head revisions
+// of the local repository and outputs the per-resource differences, followed by the resources rendered
+// more than once at the head revision
+func generateAndOutputDiff(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	filename string,
+	load applicationsLoader,
+	base string,
+	head string,
+	appFilter AppFilter,
+	filter ResourceFilter,
+	output string,
+	maxDiffLines int,
+) []DuplicateResource {
+	errors.CheckError(checkDiffFormat(output))
+	appsMatcher := appFilter.mustCompile()
+	matcher := filter.mustCompile()
+
+	baseResources, _, err := renderRevision(ctx, opts, filename, base, load, appsMatcher, matcher)
+	errors.CheckError(err)
+	headResources, duplicates, err := renderRevision(ctx, opts, filename, head, load, appsMatcher, matcher)
+	errors.CheckError(err)
+
+	diffs, err := DiffApplications(baseResources, headResources)
+	errors.CheckError(err)
+	report := ReportOptions{
+		Title:        fmt.Sprintf("Diff of %s between %s and %s", filepath.Base(filename), base, head),
+		MaxDiffLines: maxDiffLines,
+		Duplicates:   duplicates,
+	}
+	errors.CheckError(writeDiffReport(w, diffs, output, report, writeDiff))
+	return duplicates
+}
+
+// renderRevision renders the Applications of a manifest file as it is at the given revision,
+// with the sources pointing to the local repository resolved to that same revision.
+// Returns the resources keyed by Application name, and the resources rendered more than once.
+func renderRevision(
+	ctx context.Context,
+	opts Options,
+	filename string,
+	revision string,
+	load applicationsLoader,
+	appsMatcher *appMatcher,
+	matcher *resourceMatcher,
+) (map[string][]*unstructured.Unstructured, []DuplicateResource, error) {
+	rendered := map[string][]*unstructured.Unstructured{}
+
+	content, found, err := readFileAtRevision(filename, revision)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !found {
+		log.Infof("%s does not exist at revision %s", filename, revision)
+		return rendered, nil, nil
+	}
+
+	tmpFile, err := os.CreateTemp("", "argocd-offline-cli-*.yaml")
+	if err != nil {
+		return nil, nil, err
+	}
+	defer func() { _ = os.Remove(tmpFile.Name()) }()
+	if _, err := tmpFile.Write(content); err != nil {
+		_ = tmpFile.Close()
+		return nil, nil, err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return nil, nil, err
+	}
+
+	opts.LocalRevision = revision
+	renderer, err := NewRenderer(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer renderer.Close()
+	apps, err := load(ctx, renderer, tmpFile.Name())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load %s at revision %s: %w", filename, revision, err)
+	}
+
+	selected := appsMatcher.selectApplications(apps)
+
+	results, duplicates, err := renderer.RenderApplicationsWithDuplicates(ctx, selected)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to render revision %s: %w", revision, err)
+	}
+	for i, resources := range results {
+		filtered := make([]*unstructured.Unstructured, 0, len(resources))
+		for _, resource := range resources {
+			if matcher.matches(resource) {
+				filtered = append(filtered, resource)
+			}
+		}
+		rendered[selected[i].Name] = filtered
+	}
+	return rendered, duplicates, nil
+}
+
+// readFileAtRevision returns the content of a file of the local repository at the given revision,
+// and false if the file does not exist at that revision
+func readFileAtRevision(filename string, revision string) ([]byte, bool, error) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, false, err
+	}
+	dir, base := filepath.Split(path)
+
+	// Fail on unknown revisions rather than reporting the file as missing
+	if _, err := resolveLocalRevisionAt(dir, revision); err != nil {
+		return nil, false, err
+	}
+
+	object := revision + ":./" + base
+	if err := exec.Command("git", "-C", dir, "cat-file", "-e", object).Run(); err != nil {
+		return nil, false, nil
+	}
+	content, err := exec.Command("git", "-C", dir, "show", object).Output()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read %s at revision %s: %w", filename, revision, err)
+	}
+	return content, true, nil
+}
+
+// DiffApplications compares the resources rendered for each Application, keyed by Application name.
+// Only the Applications and resources that differ are returned, sorted by name.
+func DiffApplications(base, head map[string][]*unstructured.Unstructured) ([]ApplicationDiff, error) {
+	names := map[string]bool{}
+	for name := range base {
+		names[name] = true
+	}
+	for name := range head {
+		names[name] = true
+	}
+	sortedNames := make([]string, 0, len(names))
+	for name := range names {
+		sortedNames = append(sortedNames, name)
+	}
+	sort.Strings(sortedNames)
+
+	var diffs []ApplicationDiff
+	for _, name := range sortedNames {
+		baseResources, inBase := base[name]
+		headResources, inHead := head[name]
+
+		resources, err := DiffResources(baseResources, headResources)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff application '%s': %w", name, err)
+		}
+
+		change := ChangeModified
+		switch {
+		case !inBase:
+			change = ChangeAdded
+		case !inHead:
+			change = ChangeRemoved
+		case len(resources) == 0:
+			continue
+		}
+		diffs = append(diffs, ApplicationDiff{Name: name, Change: change, Resources: resources})
+	}
+	return diffs, nil
+}
+
+// DiffResources compares two renders of the resources of an Application.
+// Only the resources that differ are returned, sorted by name, namespace, kind and group.
+func DiffResources(base, head []*unstructured.Unstructured) ([]ResourceDiff, error) {
+	return diffResources(base, head, "base", "head")
+}
+
+// diffResources compares two sets of resources, labelling the sides of the unified diffs
+func diffResources(base, head []*unstructured.Unstructured, fromLabel, toLabel string) ([]ResourceDiff, error) {
+	baseByKey := resourcesByKey(base)
+	headByKey := resourcesByKey(head)
+
+	keys := make([]kube.ResourceKey, 0, len(baseByKey)+len(headByKey))
+	for key := range baseByKey {
+		keys = append(keys, key)
+	}
+	for key := range headByKey {
+		if _, ok := baseByKey[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return compareKeysByName(keys[i], keys[j]) < 0 })
+
+	var diffs []ResourceDiff
+	for _, key := range keys {
+		from, err := marshalResource(baseByKey[key])
+		if err != nil {
+			return nil, err
+		}
+		to, err := marshalResource(headByKey[key])
+		if err != nil {
+			return nil, err
+		}
+		if from == to {
+			continue
+		}
+
+		change := ChangeModified
+		switch {
+		case baseByKey[key] == nil:
+			change = ChangeAdded
+		case headByKey[key] == nil:
+			change = ChangeRemoved
+		}
+
+		diff, err := unifiedDiff(key, from, to, fromLabel, toLabel)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, ResourceDiff{Key: key, Change: change, Diff: diff})
+	}
+	return diffs, nil
+}
+
+// unifiedDiff returns the unified diff of two YAML representations of a resource
+func unifiedDiff(key kube.ResourceKey, from, to string, fromLabel, toLabel string) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(from),
+		B:        splitLines(to),
+		FromFile: fromLabel + "/" + key.String(),
+		ToFile:   toLabel + "/" + key.String(),
+		Context:  3,
+	})
+}
+
+// splitLines splits a text into lines for difflib, an empty text having no line at all
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return difflib.SplitLines(s)
+}
+
+// resourcesByKey indexes resources by their group/kind/namespace/name key
+func resourcesByKey(resources []*unstructured.Unstructured) map[kube.ResourceKey]*unstructured.Unstructured {
+	byKey := make(map[kube.ResourceKey]*unstructured.Unstructured, len(resources))
+	for _, resource := range resources {
+		byKey[kube.GetResourceKey(resource)] = resource
+	}
+	return byKey
+}
+
+// marshalResource returns the YAML representation of a resource, or an empty string for a nil resource
+func marshalResource(resource *unstructured.Unstructured) (string, error) {
+	if resource == nil {
+		return "", nil
+	}
+	data, err := yaml.Marshal(resource.Object)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal resource to yaml: %w", err)
+	}
+	return string(data), nil
+}
+
+// writeDiff writes the differences of each Application followed by its resource unified diffs
+func writeDiff(w io.Writer, diffs []ApplicationDiff) error {
+	if len(diffs) == 0 {
+		_, err := fmt.Fprintln(w, "No differences found")
+		return err
+	}
+	for _, appDiff := range diffs {
+		if _, err := fmt.Fprintf(w, "===== Application %s (%s) =====\n", appDiff.Name, appDiff.Change); err != nil {
+			return err
+		}
+		for _, resourceDiff := range appDiff.Resources {
+			if _, err := fmt.Fprint(w, resourceDiff.Diff); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
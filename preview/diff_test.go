@@ -0,0 +1,113 @@
+package preview
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// mustParseManifests parses JSON manifests, failing the test on error
+func mustParseManifests(t *testing.T, manifests ...string) []*unstructured.Unstructured {
+	t.Helper()
+	resources, err := parseManifests(manifests)
+	require.NoError(t, err)
+	return resources
+}
+
+// TestDiffResources verifies that added, removed and modified resources are reported with unified diffs
+func TestDiffResources(t *testing.T) {
+	base := mustParseManifests(t,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"unchanged"},"data":{"a":"1"}}`,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"removed"}}`,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"prod"},"spec":{"replicas":1}}`,
+	)
+	head := mustParseManifests(t,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"prod"},"spec":{"replicas":2}}`,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"unchanged"},"data":{"a":"1"}}`,
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"added"}}`,
+	)
+
+	diffs, err := DiffResources(base, head)
+	require.NoError(t, err)
+	require.Len(t, diffs, 3)
+
+	require.Equal(t, "/Service//added", diffs[0].Key.String())
+	require.Equal(t, ChangeAdded, diffs[0].Change)
+	require.Equal(t, "/ConfigMap//removed", diffs[1].Key.String())
+	require.Equal(t, ChangeRemoved, diffs[1].Change)
+	require.Equal(t, "apps/Deployment/prod/web", diffs[2].Key.String())
+	require.Equal(t, ChangeModified, diffs[2].Change)
+	require.Contains(t, diffs[2].Diff, "--- base/apps/Deployment/prod/web\n+++ head/apps/Deployment/prod/web\n")
+	require.Contains(t, diffs[2].Diff, "-  replicas: 1\n+  replicas: 2\n")
+}
+
+// TestDiffApplications verifies that added and removed Applications are reported,
+// and that Applications without differences are omitted
+func TestDiffApplications(t *testing.T) {
+	configMap := `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"config"}}`
+	base := map[string][]*unstructured.Unstructured{
+		"unchanged": mustParseManifests(t, configMap),
+		"removed":   mustParseManifests(t, configMap),
+	}
+	head := map[string][]*unstructured.Unstructured{
+		"unchanged": mustParseManifests(t, configMap),
+		"added":     mustParseManifests(t, configMap),
+	}
+
+	diffs, err := DiffApplications(base, head)
+	require.NoError(t, err)
+	require.Len(t, diffs, 2)
+	require.Equal(t, "added", diffs[0].Name)
+	require.Equal(t, ChangeAdded, diffs[0].Change)
+	require.Len(t, diffs[0].Resources, 1)
+	require.Equal(t, "removed", diffs[1].Name)
+	require.Equal(t, ChangeRemoved, diffs[1].Change)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeDiff(&buf, diffs))
+	require.Contains(t, buf.String(), "===== Application added (added) =====\n--- base//ConfigMap//config\n")
+
+	buf.Reset()
+	require.NoError(t, writeDiff(&buf, nil))
+	require.Equal(t, "No differences found\n", buf.String())
+}
+
+// TestReadFileAtRevision verifies that a file is read as committed at the given revision
+func TestReadFileAtRevision(t *testing.T) {
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.com"},
+			args...)...)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	filename := filepath.Join(dir, "app.yaml")
+
+	git("init", "-q")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "other.yaml"), []byte("other"), 0o600))
+	git("add", "other.yaml")
+	git("commit", "-q", "-m", "first")
+	git("tag", "first")
+	require.NoError(t, os.WriteFile(filename, []byte("committed"), 0o600))
+	git("add", "app.yaml")
+	git("commit", "-q", "-m", "second")
+	require.NoError(t, os.WriteFile(filename, []byte("uncommitted"), 0o600))
+
+	content, found, err := readFileAtRevision(filename, "HEAD")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "committed", string(content))
+
+	_, found, err = readFileAtRevision(filename, "first")
+	require.NoError(t, err)
+	require.False(t, found, "file did not exist at the first commit")
+
+	_, _, err = readFileAtRevision(filename, "unknown")
+	require.Error(t, err)
+}
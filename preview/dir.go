@@ -0,0 +1,99 @@
+package preview
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// outputFormatDirPrefix selects the directory output, as in "dir=PATH"
+const outputFormatDirPrefix = "dir="
+
+// fileNameReplacer replaces the characters that cannot be used in a file name
+var fileNameReplacer = strings.NewReplacer("/", "_", "\\", "_", ":", "_")
+
+// resourceFileName returns the path of the file of a resource relative to its Application directory:
+// [<namespace>/]<kind>[.<group>]_<name>.yaml. The underscore cannot appear in a kind, a group or a namespace,
+// so that different resources are not written to the same file.
+func resourceFileName(resource unstructured.Unstructured) string {
+	kind := strings.ToLower(resource.GetKind())
+	if group := resource.GroupVersionKind().Group; group != "" {
+		kind += "." + group
+	}
+	return filepath.Join(resource.GetNamespace(), kind+"_"+fileNameReplacer.Replace(resource.GetName())+".yaml")
+}
+
+// applicationDir returns the directory the resources of an Application are written to: dir/<appName>/, the
+// Application name being rejected unless it stands for a direct child of dir
+func applicationDir(dir string, appName string) (string, error) {
+	name := fileNameReplacer.Replace(appName)
+	appDir := filepath.Join(dir, name)
+	if name == "" || name == "." || name == ".." || filepath.Dir(appDir) != filepath.Clean(dir) {
+		return "", fmt.Errorf("application name '%s' cannot be used as a directory name", appName)
+	}
+	return appDir, nil
+}
+
+// checkApplicationDirs returns an error if the resources of several Applications would be written to the same
+// directory, or if the name of an Application cannot be used as a directory name
+func checkApplicationDirs(dir string, apps []argoappv1.Application) error {
+	owners := map[string]string{}
+	for _, app := range apps {
+		appDir, err := applicationDir(dir, app.Name)
+		if err != nil {
+			return err
+		}
+		if owner, ok := owners[appDir]; ok {
+			return fmt.Errorf("applications '%s' and '%s' would be written to the same directory %s",
+				owner, app.Name, appDir)
+		}
+		owners[appDir] = app.Name
+	}
+	return nil
+}
+
+// writeResourcesToDir writes one YAML file per resource into dir/<appName>/, the namespaced resources into
+// a subdirectory of their namespace. The Application directory is emptied first so that removed resources
+// also disappear from the tree.
+func writeResourcesToDir(dir string, appName string, resources map[string][]unstructured.Unstructured) error {
+	if dir == "" {
+		return fmt.Errorf("missing directory in output format, expected %sPATH", outputFormatDirPrefix)
+	}
+
+	appDir, err := applicationDir(dir, appName)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(appDir); err != nil {
+		return fmt.Errorf("failed to clean directory %s: %w", appDir, err)
+	}
+	if err := os.MkdirAll(appDir, 0o750); err != nil {
+		return fmt.Errorf("failed to create directory %s: %w", appDir, err)
+	}
+
+	for _, kindResources := range resources {
+		for _, resource := range kindResources {
+			data, err := yaml.Marshal(resource.Object)
+			if err != nil {
+				return fmt.Errorf("unable to marshal resource to yaml: %w", err)
+			}
+			path := filepath.Join(appDir, resourceFileName(resource))
+			if _, err := os.Stat(path); err == nil {
+				return fmt.Errorf("application '%s' renders more than one resource written to %s", appName, path)
+			}
+			if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(path), err)
+			}
+			if err := os.WriteFile(path, data, 0o600); err != nil {
+				return fmt.Errorf("failed to write %s: %w", path, err)
+			}
+		}
+	}
+
+	return nil
+}
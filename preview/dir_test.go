@@ -0,0 +1,91 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+// TestResourceFileName verifies that namespaced resources are written to a subdirectory of their namespace,
+// and that resources differing by group, namespace or name are written to different files
+func TestResourceFileName(t *testing.T) {
+	resources, err := parseManifests([]string{
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"prod"}}`,
+		`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"prod"}}`,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"a:b/c"}}`,
+		`{"apiVersion":"v1","kind":"Event","metadata":{"name":"a-b","namespace":"c"}}`,
+		`{"apiVersion":"events.k8s.io/v1","kind":"Event","metadata":{"name":"a-b","namespace":"c"}}`,
+		`{"apiVersion":"v1","kind":"Event","metadata":{"name":"b","namespace":"c-a"}}`,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, "prod/deployment.apps_web.yaml", resourceFileName(*resources[0]))
+	require.Equal(t, "namespace_prod.yaml", resourceFileName(*resources[1]))
+	require.Equal(t, "configmap_a_b_c.yaml", resourceFileName(*resources[2]))
+	require.Equal(t, "c/event_a-b.yaml", resourceFileName(*resources[3]))
+	require.Equal(t, "c/event.events.k8s.io_a-b.yaml", resourceFileName(*resources[4]))
+	require.Equal(t, "c-a/event_b.yaml", resourceFileName(*resources[5]))
+}
+
+// TestWriteResourcesToDir verifies that one file is written per resource and that
+// files from a previous render of the same Application are removed
+func TestWriteResourcesToDir(t *testing.T) {
+	dir := t.TempDir()
+	stale := filepath.Join(dir, "guestbook", "service_old.yaml")
+	require.NoError(t, os.MkdirAll(filepath.Dir(stale), 0o750))
+	require.NoError(t, os.WriteFile(stale, []byte("stale"), 0o600))
+
+	manifests, err := parseManifests([]string{
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"prod"}}`,
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"}}`,
+	})
+	require.NoError(t, err)
+	all := mustCompileFilter(t, ResourceFilter{})
+	require.NoError(t, writeResourcesToDir(dir, "guestbook", filterResources(manifests, all)))
+
+	require.NoFileExists(t, stale)
+	data, err := os.ReadFile(filepath.Join(dir, "guestbook", "prod", "deployment.apps_web.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: web\n  namespace: prod\n", string(data))
+	require.FileExists(t, filepath.Join(dir, "guestbook", "service_web.yaml"))
+}
+
+// TestWriteResourcesToDirDuplicate verifies that two resources written to the same file are reported
+func TestWriteResourcesToDirDuplicate(t *testing.T) {
+	manifests, err := parseManifests([]string{
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"}}`,
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"}}`,
+	})
+	require.NoError(t, err)
+
+	all := mustCompileFilter(t, ResourceFilter{})
+	err = writeResourcesToDir(t.TempDir(), "guestbook", filterResources(manifests, all))
+	require.ErrorContains(t, err, "more than one resource")
+
+	require.ErrorContains(t, writeResourcesToDir("", "guestbook", nil), "missing directory")
+}
+
+// TestCheckApplicationDirs verifies that the Application names standing for another directory than a child of
+// the output directory are rejected, as well as the Applications sharing the same directory
+func TestCheckApplicationDirs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"", ".", ".."} {
+		_, err := applicationDir(dir, name)
+		require.ErrorContains(t, err, "cannot be used as a directory name", name)
+		require.ErrorContains(t, writeResourcesToDir(dir, name, nil), "cannot be used as a directory name", name)
+	}
+	require.DirExists(t, dir)
+
+	appDir, err := applicationDir(dir, "a/b")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "a_b"), appDir)
+
+	apps := []argoappv1.Application{newDestinationApp("a/b", "prod"), newDestinationApp("web", "prod")}
+	require.NoError(t, checkApplicationDirs(dir, apps))
+	apps = append(apps, newDestinationApp("a_b", "prod"))
+	require.EqualError(t, checkApplicationDirs(dir, apps),
+		"applications 'a/b' and 'a_b' would be written to the same directory "+filepath.Join(dir, "a_b"))
+}
@@ -0,0 +1,200 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// syncOptionFailOnSharedResource is the sync option making the sync of an Application fail
+// when one of its resources is also part of another Application
+const syncOptionFailOnSharedResource = "FailOnSharedResource=true"
+
+// DuplicateResource is a resource rendered more than once, by a single Application or by several Applications
+type DuplicateResource struct {
+	Key kube.ResourceKey
+	// Applications are the Applications rendering the resource, in rendering order: a single one rendering it
+	// several times, or several ones sharing it
+	Applications []string
+	// Count is the number of times a single Application renders the resource
+	Count int
+}
+
+// Shared returns true if the resource is part of several Applications
+func (d DuplicateResource) Shared() bool {
+	return len(d.Applications) > 1
+}
+
+// String describes the duplicate resource like the Argo CD SharedResourceWarning and RepeatedResourceWarning do
+func (d DuplicateResource) String() string {
+	if d.Shared() {
+		return fmt.Sprintf("%s is part of applications %s", d.Key.String(), strings.Join(d.Applications, ", "))
+	}
+	return fmt.Sprintf("%s appeared %d times among the resources of application %s, only the last one is kept",
+		d.Key.String(), d.Count, strings.Join(d.Applications, ", "))
+}
+
+// appResourceKey returns the key of a rendered resource once applied by an Application: namespaced resources
+// without a namespace end up in the destination namespace
+func appResourceKey(
+	app argoappv1.Application,
+	scopes resourceScopes,
+	resource *unstructured.Unstructured,
+) kube.ResourceKey {
+	key := kube.GetResourceKey(resource)
+	if !scopes.isNamespaced(key.GroupKind()) {
+		key.Namespace = ""
+	} else if key.Namespace == "" {
+		key.Namespace = app.Spec.Destination.Namespace
+	}
+	return key
+}
+
+// dropRepeatedResources removes the resources rendered more than once by an Application, keeping the last one
+// like Argo CD does, and returns them, warning about them like Argo CD does with a RepeatedResourceWarning
+func dropRepeatedResources(
+	app argoappv1.Application,
+	sources renderedSources,
+) (renderedSources, []DuplicateResource) {
+	scopes := newResourceScopes(sources.flatten())
+	var keys []kube.ResourceKey
+	counts := map[kube.ResourceKey]int{}
+	for _, resource := range sources.flatten() {
+		if resource.GetName() == "" {
+			continue
+		}
+		key := appResourceKey(app, scopes, resource)
+		if counts[key] == 0 {
+			keys = append(keys, key)
+		}
+		counts[key]++
+	}
+	var repeated []DuplicateResource
+	for _, key := range keys {
+		if counts[key] > 1 {
+			duplicate := DuplicateResource{Key: key, Applications: []string{app.Name}, Count: counts[key]}
+			log.Warnf("Application %s: resource %s", app.Name, duplicate.String())
+			repeated = append(repeated, duplicate)
+		}
+	}
+	if len(repeated) == 0 {
+		return sources, nil
+	}
+
+	// Walk the resources backwards so that the last occurrence of each one is kept
+	seen := map[kube.ResourceKey]bool{}
+	kept := make(renderedSources, len(sources))
+	for i := len(sources) - 1; i >= 0; i-- {
+		for j := len(sources[i]) - 1; j >= 0; j-- {
+			resource := sources[i][j]
+			if resource.GetName() != "" {
+				key := appResourceKey(app, scopes, resource)
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+			}
+			kept[i] = append(kept[i], resource)
+		}
+		reverseResources(kept[i])
+	}
+	return kept, repeated
+}
+
+// reverseResources reverses the order of resources in place
+func reverseResources(resources []*unstructured.Unstructured) {
+	for i, j := 0, len(resources)-1; i < j; i, j = i+1, j-1 {
+		resources[i], resources[j] = resources[j], resources[i]
+	}
+}
+
+// sharedResourceKey identifies a resource across the destination clusters
+type sharedResourceKey struct {
+	cluster string
+	key     kube.ResourceKey
+}
+
+// checkSharedResources returns the resources rendered by more than one Application, which fight each other
+// in the cluster, warning about them like Argo CD does with a SharedResourceWarning. The Applications with the
+// FailOnSharedResource sync option fail, as their sync would.
+func checkSharedResources(apps []argoappv1.Application, rendered []renderedSources) ([]DuplicateResource, error) {
+	var keys []sharedResourceKey
+	owners := map[sharedResourceKey][]int{}
+	for i, sources := range rendered {
+		resources := sources.flatten()
+		scopes := newResourceScopes(resources)
+		cluster := destinationKey(apps[i])
+		for _, resource := range resources {
+			if resource.GetName() == "" {
+				continue
+			}
+			key := sharedResourceKey{cluster: cluster, key: appResourceKey(apps[i], scopes, resource)}
+			if len(owners[key]) == 0 {
+				keys = append(keys, key)
+			}
+			if n := len(owners[key]); n == 0 || owners[key][n-1] != i {
+				owners[key] = append(owners[key], i)
+			}
+		}
+	}
+
+	var shared []DuplicateResource
+	var errs []error
+	for _, key := range keys {
+		if len(owners[key]) < 2 {
+			continue
+		}
+		duplicate := DuplicateResource{Key: key.key}
+		for _, i := range owners[key] {
+			duplicate.Applications = append(duplicate.Applications, apps[i].Name)
+		}
+		log.Warn(duplicate.String())
+		shared = append(shared, duplicate)
+		for _, i := range owners[key] {
+			if failsOnSharedResource(apps[i]) {
+				errs = append(errs, fmt.Errorf("application '%s': shared resource found: %s", apps[i].Name, duplicate))
+			}
+		}
+	}
+	return shared, errors.Join(errs...)
+}
+
+// failsOnSharedResource returns true if the sync of an Application fails when it shares resources
+func failsOnSharedResource(app argoappv1.Application) bool {
+	return app.Spec.SyncPolicy != nil && app.Spec.SyncPolicy.SyncOptions.HasOption(syncOptionFailOnSharedResource)
+}
+
+// printDuplicates writes the duplicate resources after the output of a command: as a list after the name, table,
+// plan and text outputs, and as comments after a YAML stream. The other outputs are meant to be parsed, so the
+// duplicates are only reported by the warnings.
+func printDuplicates(w io.Writer, duplicates []DuplicateResource, output string) error {
+	if len(duplicates) == 0 {
+		return nil
+	}
+	prefix := ""
+	switch output {
+	case outputFormatName, outputFormatTable, outputFormatWide, outputFormatPlan, diffFormatText:
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	case outputFormatYAML:
+		prefix = "# "
+	default:
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "%sDuplicate resources:\n", prefix); err != nil {
+		return err
+	}
+	for _, duplicate := range duplicates {
+		if _, err := fmt.Fprintf(w, "%s- %s\n", prefix, duplicate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
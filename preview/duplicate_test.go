@@ -0,0 +1,129 @@
+package preview
+
+import (
+	"bytes"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newDestinationApp returns an Application deployed to a namespace of the in-cluster cluster
+func newDestinationApp(name string, namespace string) argoappv1.Application {
+	return argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: argoappv1.ApplicationSpec{
+			Destination: argoappv1.ApplicationDestination{Server: inClusterServer, Namespace: namespace},
+		},
+	}
+}
+
+// TestDropRepeatedResources verifies that the last occurrence of a resource rendered several times is kept,
+// whether it is repeated within a source or across sources
+func TestDropRepeatedResources(t *testing.T) {
+	app := newDestinationApp("web", "prod")
+	sources := renderedSources{
+		mustParseManifests(t,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings"},"data":{"v":"1"}}`,
+			`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"}}`,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings","namespace":"prod"},"data":{"v":"2"}}`,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings","namespace":"other"}}`,
+		),
+		mustParseManifests(t,
+			`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"prod"}}`,
+			`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"prod","namespace":"prod"}}`,
+			`{"apiVersion":"batch/v1","kind":"Job","metadata":{"generateName":"migrate-"}}`,
+			`{"apiVersion":"batch/v1","kind":"Job","metadata":{"generateName":"migrate-"}}`,
+			`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","namespace":"prod"}}`,
+		),
+	}
+
+	kept, repeated := dropRepeatedResources(app, sources)
+	require.Len(t, kept, 2)
+	require.Equal(t, []string{"ConfigMap/settings", "ConfigMap/settings"}, resourceNames(kept[0]))
+	require.Equal(t, "2", kept[0][0].Object["data"].(map[string]any)["v"])
+	require.Equal(t, "other", kept[0][1].GetNamespace())
+	require.Len(t, kept[1], 4)
+	require.Equal(t, "prod", kept[1][0].GetNamespace())
+	require.Equal(t, "Service", kept[1][3].GetKind())
+	require.Equal(t, []string{
+		"/ConfigMap/prod/settings appeared 2 times among the resources of application web, only the last one is kept",
+		"/Service/prod/web appeared 2 times among the resources of application web, only the last one is kept",
+		"/Namespace//prod appeared 2 times among the resources of application web, only the last one is kept",
+	}, duplicateStrings(repeated))
+
+	kept, repeated = dropRepeatedResources(app, renderedSources{sources[0][1:2]})
+	require.Empty(t, repeated)
+	require.Len(t, kept[0], 1)
+}
+
+// duplicateStrings returns the descriptions of duplicate resources
+func duplicateStrings(duplicates []DuplicateResource) []string {
+	var descriptions []string
+	for _, duplicate := range duplicates {
+		descriptions = append(descriptions, duplicate.String())
+	}
+	return descriptions
+}
+
+// TestCheckSharedResources verifies that the resources rendered by several Applications to the same cluster
+// are reported, failing the Applications with the FailOnSharedResource sync option
+func TestCheckSharedResources(t *testing.T) {
+	web := newDestinationApp("web", "prod")
+	api := newDestinationApp("api", "prod")
+	staging := newDestinationApp("staging", "staging")
+	remote := newDestinationApp("remote", "prod")
+	remote.Spec.Destination.Server = "https://remote.example.com"
+	apps := []argoappv1.Application{web, api, staging, remote}
+	rendered := []renderedSources{
+		{mustParseManifests(t,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"shared"}}`,
+			`{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"ClusterRole","metadata":{"name":"reader"}}`,
+		)},
+		{mustParseManifests(t, `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"shared","namespace":"prod"}}`)},
+		{mustParseManifests(t,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"shared"}}`,
+			`{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"ClusterRole","metadata":{"name":"reader"}}`,
+		)},
+		{mustParseManifests(t, `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"shared"}}`)},
+	}
+	shared, err := checkSharedResources(apps, rendered)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"/ConfigMap/prod/shared is part of applications web, api",
+		"rbac.authorization.k8s.io/ClusterRole//reader is part of applications web, staging",
+	}, duplicateStrings(shared))
+	require.True(t, shared[0].Shared())
+
+	apps[1].Spec.SyncPolicy = &argoappv1.SyncPolicy{SyncOptions: argoappv1.SyncOptions{"FailOnSharedResource=true"}}
+	apps[2].Spec.SyncPolicy = &argoappv1.SyncPolicy{SyncOptions: argoappv1.SyncOptions{"FailOnSharedResource=true"}}
+	_, err = checkSharedResources(apps, rendered)
+	require.EqualError(t, err, "application 'api': shared resource found: "+
+		"/ConfigMap/prod/shared is part of applications web, api\n"+
+		"application 'staging': shared resource found: "+
+		"rbac.authorization.k8s.io/ClusterRole//reader is part of applications web, staging")
+}
+
+// TestPrintDuplicates verifies that the duplicate resources are listed after the human-readable outputs,
+// as comments after a YAML stream, and not at all after the outputs meant to be parsed
+func TestPrintDuplicates(t *testing.T) {
+	duplicates := []DuplicateResource{{
+		Key:          kube.ResourceKey{Kind: "ConfigMap", Namespace: "prod", Name: "shared"},
+		Applications: []string{"web", "api"},
+	}}
+
+	var b bytes.Buffer
+	require.NoError(t, printDuplicates(&b, duplicates, outputFormatTable))
+	require.Equal(t, "\nDuplicate resources:\n- /ConfigMap/prod/shared is part of applications web, api\n", b.String())
+
+	b.Reset()
+	require.NoError(t, printDuplicates(&b, duplicates, outputFormatYAML))
+	require.Equal(t, "# Duplicate resources:\n# - /ConfigMap/prod/shared is part of applications web, api\n", b.String())
+
+	b.Reset()
+	require.NoError(t, printDuplicates(&b, duplicates, outputFormatJSON))
+	require.NoError(t, printDuplicates(&b, nil, outputFormatTable))
+	require.Empty(t, b.String())
+}
@@ -0,0 +1,290 @@
+package preview
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// coreGroupAlias designates the core API group, whose name is empty
+const coreGroupAlias = "core"
+
+// kindShortNames maps the short names of the built-in and Argo CD resources to their lowercased kind,
+// since no API server is available to discover them
+var kindShortNames = map[string]string{
+	"cm":       "configmap",
+	"cs":       "componentstatus",
+	"ep":       "endpoints",
+	"ev":       "event",
+	"limits":   "limitrange",
+	"ns":       "namespace",
+	"no":       "node",
+	"pvc":      "persistentvolumeclaim",
+	"pv":       "persistentvolume",
+	"po":       "pod",
+	"rc":       "replicationcontroller",
+	"quota":    "resourcequota",
+	"sa":       "serviceaccount",
+	"svc":      "service",
+	"crd":      "customresourcedefinition",
+	"crds":     "customresourcedefinition",
+	"ds":       "daemonset",
+	"deploy":   "deployment",
+	"rs":       "replicaset",
+	"sts":      "statefulset",
+	"hpa":      "horizontalpodautoscaler",
+	"cj":       "cronjob",
+	"csr":      "certificatesigningrequest",
+	"ing":      "ingress",
+	"netpol":   "networkpolicy",
+	"pdb":      "poddisruptionbudget",
+	"pc":       "priorityclass",
+	"sc":       "storageclass",
+	"app":      "application",
+	"apps":     "application",
+	"appset":   "applicationset",
+	"appsets":  "applicationset",
+	"appproj":  "appproject",
+	"appprojs": "appproject",
+}
+
+// ResourceFilter selects rendered resources. Empty fields match every resource, and set fields are combined.
+type ResourceFilter struct {
+	// Kind is a comma separated list of kinds, each given like kubectl accepts it: kind, plural or short name,
+	// optionally qualified by the API group (e.g. deploy, deployments.apps, ingress.v1.networking.k8s.io)
+	Kind string
+	// Group is the API group of the resources, "core" designating the core group
+	Group string
+	// Namespace is the namespace of the resources
+	Namespace string
+	// Name is a glob (e.g. web-*), or a regular expression when enclosed in slashes (e.g. /^web-(a|b)$/)
+	Name string
+	// Selector is a label selector (e.g. app=web,tier!=cache)
+	Selector string
+	// Annotations are the keys of the annotations the resources must have
+	Annotations []string
+}
+
+// kindFilter is a kind to match, as parsed from ResourceFilter.Kind
+type kindFilter struct {
+	name string
+	// qualifier is the group or version.group qualifying the kind, if any
+	qualifier string
+}
+
+// resourceMatcher is a compiled ResourceFilter
+type resourceMatcher struct {
+	kinds       []kindFilter
+	group       *string
+	namespace   string
+	name        func(string) bool
+	selector    labels.Selector
+	annotations []string
+}
+
+// compile validates the filter and prepares it for matching resources
+func (f ResourceFilter) compile() (*resourceMatcher, error) {
+	m := &resourceMatcher{namespace: f.Namespace, annotations: f.Annotations}
+
+	for _, kind := range strings.Split(strings.ToLower(f.Kind), ",") {
+		kind = strings.TrimSpace(kind)
+		if kind == "" {
+			continue
+		}
+		name, qualifier, _ := strings.Cut(kind, ".")
+		m.kinds = append(m.kinds, kindFilter{name: name, qualifier: qualifier})
+	}
+
+	if shouldMatch(f.Group) {
+		group := f.Group
+		if group == coreGroupAlias {
+			group = ""
+		}
+		m.group = &group
+	}
+
+	if shouldMatch(f.Name) {
+		match, err := compileNamePattern(f.Name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource name filter: %w", err)
+		}
+		m.name = match
+	}
+
+	if shouldMatch(f.Selector) {
+		selector, err := labels.Parse(f.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resource label selector: %w", err)
+		}
+		m.selector = selector
+	}
+	return m, nil
+}
+
+// mustCompile compiles the filter, exiting on failure
+func (f ResourceFilter) mustCompile() *resourceMatcher {
+	m, err := f.compile()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return m
+}
+
+// matches returns true if the resource is selected by every filter
+func (m *resourceMatcher) matches(resource *unstructured.Unstructured) bool {
+	gvk := resource.GroupVersionKind()
+	if len(m.kinds) > 0 && !m.matchesKind(gvk) {
+		return false
+	}
+	if m.group != nil && *m.group != gvk.Group {
+		return false
+	}
+	if shouldMatch(m.namespace) && m.namespace != resource.GetNamespace() {
+		return false
+	}
+	if m.name != nil && !m.name(resource.GetName()) {
+		return false
+	}
+	if m.selector != nil && !m.selector.Matches(labels.Set(resource.GetLabels())) {
+		return false
+	}
+	resourceAnnotations := resource.GetAnnotations()
+	for _, key := range m.annotations {
+		if _, ok := resourceAnnotations[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesKind returns true if any of the kind filters designates the given kind
+func (m *resourceMatcher) matchesKind(gvk schema.GroupVersionKind) bool {
+	kind := strings.ToLower(gvk.Kind)
+	plural, _ := meta.UnsafeGuessKindToResource(gvk)
+	for _, filter := range m.kinds {
+		if filter.name != kind && filter.name != plural.Resource && kindShortNames[filter.name] != kind {
+			continue
+		}
+		if filter.qualifier == "" ||
+			filter.qualifier == gvk.Group ||
+			filter.qualifier == gvk.Version+"."+gvk.Group {
+			return true
+		}
+	}
+	return false
+}
+
+// compileNamePattern returns a function matching names against a glob pattern (e.g. web-*),
+// or against a regular expression when the pattern is enclosed in slashes (e.g. /^web-(a|b)$/)
+func compileNamePattern(pattern string) (func(string) bool, error) {
+	if isRegexpPattern(pattern) {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, err
+		}
+		return re.MatchString, nil
+	}
+
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob pattern '%s': %w", pattern, err)
+	}
+	return func(name string) bool {
+		matched, _ := path.Match(pattern, name)
+		return matched
+	}, nil
+}
+
+// AppFilter selects Applications. Empty fields match every Application, and set fields are combined.
+type AppFilter struct {
+	// Names are globs, or regular expressions when enclosed in slashes. Applications matching any of them are selected.
+	Names []string
+	// Selector is a label selector matched against the Application labels (e.g. team=x,env=staging)
+	Selector string
+}
+
+// appMatcher is a compiled AppFilter
+type appMatcher struct {
+	names    []func(string) bool
+	selector labels.Selector
+	// exactName is set when the filter designates a single Application by its name
+	exactName string
+}
+
+// compile validates the filter and prepares it for matching Applications
+func (f AppFilter) compile() (*appMatcher, error) {
+	m := &appMatcher{}
+	for _, name := range f.Names {
+		match, err := compileNamePattern(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid application name filter: %w", err)
+		}
+		m.names = append(m.names, match)
+	}
+
+	if shouldMatch(f.Selector) {
+		selector, err := labels.Parse(f.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid application label selector: %w", err)
+		}
+		m.selector = selector
+	}
+
+	if len(f.Names) == 1 && isLiteralName(f.Names[0]) && m.selector == nil {
+		m.exactName = f.Names[0]
+	}
+	return m, nil
+}
+
+// mustCompile compiles the filter, exiting on failure
+func (f AppFilter) mustCompile() *appMatcher {
+	m, err := f.compile()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return m
+}
+
+// matches returns true if the Application is selected by the filter
+func (m *appMatcher) matches(app argoappv1.Application) bool {
+	if m.selector != nil && !m.selector.Matches(labels.Set(app.Labels)) {
+		return false
+	}
+	if len(m.names) == 0 {
+		return true
+	}
+	for _, match := range m.names {
+		if match(app.Name) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectApplications returns the Applications selected by the filter
+func (m *appMatcher) selectApplications(apps []argoappv1.Application) []argoappv1.Application {
+	selected := make([]argoappv1.Application, 0, len(apps))
+	for _, app := range apps {
+		if m.matches(app) {
+			selected = append(selected, app)
+		}
+	}
+	return selected
+}
+
+// isLiteralName returns true if a name pattern is neither a regular expression nor a glob with wildcards
+func isLiteralName(pattern string) bool {
+	return !isRegexpPattern(pattern) && !strings.ContainsAny(pattern, `*?[\`)
+}
+
+// isRegexpPattern returns true if a name pattern is a regular expression enclosed in slashes
+func isRegexpPattern(pattern string) bool {
+	return len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
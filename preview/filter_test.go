@@ -0,0 +1,129 @@
+package preview
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mustCompileFilter compiles a resource filter, failing the test on error
+func mustCompileFilter(t *testing.T, filter ResourceFilter) *resourceMatcher {
+	t.Helper()
+	matcher, err := filter.compile()
+	require.NoError(t, err)
+	return matcher
+}
+
+// mustCompileAppFilter compiles an Application filter, failing the test on error
+func mustCompileAppFilter(t *testing.T, filter AppFilter) *appMatcher {
+	t.Helper()
+	matcher, err := filter.compile()
+	require.NoError(t, err)
+	return matcher
+}
+
+// matchedNames returns the names of the test resources selected by the filter
+func matchedNames(t *testing.T, filter ResourceFilter) []string {
+	t.Helper()
+	resources := mustParseManifests(t,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"prod",`+
+			`"labels":{"app":"web","tier":"frontend"}}}`,
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web-svc","namespace":"prod",`+
+			`"labels":{"app":"web"},"annotations":{"service.beta.kubernetes.io/internal":"true"}}}`,
+		`{"apiVersion":"networking.k8s.io/v1","kind":"Ingress","metadata":{"name":"web","namespace":"staging"}}`,
+		`{"apiVersion":"argoproj.io/v1alpha1","kind":"Application","metadata":{"name":"child"}}`,
+	)
+
+	matcher := mustCompileFilter(t, filter)
+	var names []string
+	for _, resource := range resources {
+		if matcher.matches(resource) {
+			names = append(names, resource.GetKind()+"/"+resource.GetName())
+		}
+	}
+	return names
+}
+
+// TestResourceFilterKind verifies that kinds are matched by kind, plural, short name and group qualified forms
+func TestResourceFilterKind(t *testing.T) {
+	all := []string{"Deployment/web", "Service/web-svc", "Ingress/web", "Application/child"}
+	require.Equal(t, all, matchedNames(t, ResourceFilter{}))
+
+	require.Equal(t, []string{"Deployment/web"}, matchedNames(t, ResourceFilter{Kind: "Deployment"}))
+	require.Equal(t, []string{"Deployment/web"}, matchedNames(t, ResourceFilter{Kind: "deployments"}))
+	require.Equal(t, []string{"Deployment/web"}, matchedNames(t, ResourceFilter{Kind: "deploy"}))
+	require.Equal(t, []string{"Deployment/web"}, matchedNames(t, ResourceFilter{Kind: "deployments.apps"}))
+	require.Equal(t, []string{"Deployment/web"}, matchedNames(t, ResourceFilter{Kind: "deployment.v1.apps"}))
+	require.Empty(t, matchedNames(t, ResourceFilter{Kind: "deployments.extensions"}))
+	require.Equal(t, []string{"Ingress/web"}, matchedNames(t, ResourceFilter{Kind: "ingresses.networking.k8s.io"}))
+	require.Equal(t, []string{"Deployment/web", "Service/web-svc"}, matchedNames(t, ResourceFilter{Kind: "deploy, svc"}))
+	require.Equal(t, []string{"Application/child"}, matchedNames(t, ResourceFilter{Kind: "app"}))
+}
+
+// TestResourceFilterFields verifies the group, namespace, name, label and annotation filters and their combination
+func TestResourceFilterFields(t *testing.T) {
+	require.Equal(t, []string{"Service/web-svc"}, matchedNames(t, ResourceFilter{Group: "core"}))
+	require.Equal(t, []string{"Application/child"}, matchedNames(t, ResourceFilter{Group: "argoproj.io"}))
+	require.Equal(t, []string{"Ingress/web"}, matchedNames(t, ResourceFilter{Namespace: "staging"}))
+	require.Equal(t, []string{"Service/web-svc"}, matchedNames(t, ResourceFilter{Name: "web-*"}))
+	require.Equal(t, []string{"Deployment/web", "Ingress/web"}, matchedNames(t, ResourceFilter{Name: "/^web$/"}))
+	require.Equal(t, []string{"Deployment/web"}, matchedNames(t, ResourceFilter{Selector: "app=web,tier"}))
+	require.Equal(t, []string{"Ingress/web", "Application/child"}, matchedNames(t, ResourceFilter{Selector: "!app"}))
+	require.Equal(t, []string{"Service/web-svc"},
+		matchedNames(t, ResourceFilter{Annotations: []string{"service.beta.kubernetes.io/internal"}}))
+	require.Equal(t, []string{"Ingress/web"}, matchedNames(t, ResourceFilter{Name: "web", Namespace: "staging"}))
+	require.Empty(t, matchedNames(t, ResourceFilter{Kind: "svc", Namespace: "staging"}))
+}
+
+// TestResourceFilterInvalid verifies that invalid patterns and selectors are reported
+func TestResourceFilterInvalid(t *testing.T) {
+	_, err := ResourceFilter{Name: "/(/"}.compile()
+	require.ErrorContains(t, err, "invalid resource name filter")
+
+	_, err = ResourceFilter{Name: "web-["}.compile()
+	require.ErrorContains(t, err, "invalid glob pattern")
+
+	_, err = ResourceFilter{Selector: "app in ("}.compile()
+	require.ErrorContains(t, err, "invalid resource label selector")
+}
+
+// TestAppFilter verifies that Applications are selected by name patterns and label selector
+func TestAppFilter(t *testing.T) {
+	var buf bytes.Buffer
+	filename := "../testdata/test-appset.yaml"
+
+	PreviewApplications(context.Background(), &buf, filename, AppFilter{}, outputFormatName)
+	require.Equal(t, "NAME\napplication/guestbook-staging\napplication/guestbook-production\n", buf.String())
+
+	buf.Reset()
+	PreviewApplications(context.Background(), &buf, filename, AppFilter{Names: []string{"*-prod*"}}, outputFormatName)
+	require.Equal(t, "NAME\napplication/guestbook-production\n", buf.String())
+
+	buf.Reset()
+	names := AppFilter{Names: []string{"/staging$/", "guestbook-production"}}
+	PreviewApplications(context.Background(), &buf, filename, names, outputFormatName)
+	require.Equal(t, "NAME\napplication/guestbook-staging\napplication/guestbook-production\n", buf.String())
+
+	buf.Reset()
+	PreviewApplications(context.Background(), &buf, filename, AppFilter{Selector: "env=staging"}, outputFormatName)
+	require.Equal(t, "NAME\napplication/guestbook-staging\n", buf.String())
+
+	buf.Reset()
+	both := AppFilter{Names: []string{"guestbook-*"}, Selector: "env!=staging"}
+	PreviewApplications(context.Background(), &buf, filename, both, outputFormatName)
+	require.Equal(t, "NAME\napplication/guestbook-production\n", buf.String())
+}
+
+// TestAppFilterExactName verifies that only a single literal name designates a single Application
+func TestAppFilterExactName(t *testing.T) {
+	require.Equal(t, "web", mustCompileAppFilter(t, AppFilter{Names: []string{"web"}}).exactName)
+	require.Empty(t, mustCompileAppFilter(t, AppFilter{Names: []string{"web-*"}}).exactName)
+	require.Empty(t, mustCompileAppFilter(t, AppFilter{Names: []string{"/web/"}}).exactName)
+	require.Empty(t, mustCompileAppFilter(t, AppFilter{Names: []string{"web", "api"}}).exactName)
+	require.Empty(t, mustCompileAppFilter(t, AppFilter{Names: []string{"web"}, Selector: "team=x"}).exactName)
+
+	_, err := AppFilter{Selector: "team in ("}.compile()
+	require.ErrorContains(t, err, "invalid application label selector")
+}
@@ -0,0 +1,384 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/argoproj/argo-cd/v3/common"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/util/argo"
+	argodiff "github.com/argoproj/argo-cd/v3/util/argo/diff"
+	"github.com/argoproj/argo-cd/v3/util/argo/normalizers"
+	synccommon "github.com/argoproj/gitops-engine/pkg/sync/common"
+	"github.com/argoproj/gitops-engine/pkg/sync/hook"
+	resourceutil "github.com/argoproj/gitops-engine/pkg/sync/resource"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	"github.com/argoproj/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// compareOptionIgnoreExtraneous keeps a resource requiring pruning from making its Application OutOfSync
+const compareOptionIgnoreExtraneous = "IgnoreExtraneous"
+
+// LoadLiveState loads a snapshot of live resources, as exported with `kubectl get -o yaml`.
+// List objects are expanded into their items.
+func LoadLiveState(filename string) ([]*unstructured.Unstructured, error) {
+	return loadManifestsFile(filename, "live state")
+}
+
+// loadManifestsFile loads the objects of a multi-document YAML file, expanding List objects into their items.
+// What the file holds is used in error messages.
+func loadManifestsFile(filename string, what string) ([]*unstructured.Unstructured, error) {
+	data, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", what, err)
+	}
+	objs, err := kube.SplitYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s %s: %w", what, filename, err)
+	}
+
+	var manifests []*unstructured.Unstructured
+	for _, obj := range objs {
+		if !obj.IsList() {
+			manifests = append(manifests, obj)
+			continue
+		}
+		list, err := obj.ToList()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse list in %s %s: %w", what, filename, err)
+		}
+		for i := range list.Items {
+			manifests = append(manifests, &list.Items[i])
+		}
+	}
+	return manifests, nil
+}
+
+// DiffLive compares the desired resources of an Application with a snapshot of the live state,
+// applying the normalizations of Argo CD (ignoreDifferences, managed fields, defaulted fields...)
+// before reporting the OutOfSync resources. Hooks are ignored, as they are by Argo CD.
+// Live resources that are not desired but are tracked as part of the Application require pruning
+// and are reported as removed. Those with the IgnoreExtraneous compare option do not make the
+// Application OutOfSync, and those with the Prune=false sync option are flagged as not pruned.
+// The resource customizations, compare options and tracking method of the settings are applied,
+// nil settings standing for the Argo CD defaults.
+func DiffLive(
+	app argoappv1.Application,
+	desired, live []*unstructured.Unstructured,
+	settings *ArgoCDSettings,
+) (ApplicationDiff, error) {
+	appDiff := ApplicationDiff{Name: app.Name}
+	resourceTracking := argo.NewResourceTracking()
+	config := settings.liveDiffConfig()
+
+	liveByKey := resourcesByKey(live)
+	matched := map[kube.ResourceKey]bool{}
+	var keys []kube.ResourceKey
+	var lives, targets []*unstructured.Unstructured
+
+	for _, resource := range desired {
+		if hook.IsHook(resource) {
+			continue
+		}
+		target := resource.DeepCopy()
+		key := kube.GetResourceKey(target)
+		// Argo CD places namespace-less resources in the destination namespace
+		if key.Namespace == "" {
+			namespacedKey := key
+			namespacedKey.Namespace = app.Spec.Destination.Namespace
+			if _, ok := liveByKey[namespacedKey]; ok {
+				key = namespacedKey
+			}
+		}
+		if !kube.IsCRD(target) {
+			err := resourceTracking.SetAppInstance(target, config.labelKey, app.Name, key.Namespace,
+				config.method, config.installationID)
+			if err != nil {
+				return appDiff, fmt.Errorf("failed to set tracking metadata on %s: %w", key, err)
+			}
+		}
+		matched[key] = true
+		keys = append(keys, key)
+		lives = append(lives, liveByKey[key])
+		targets = append(targets, target)
+	}
+
+	for _, resource := range live {
+		key := kube.GetResourceKey(resource)
+		if matched[key] || hook.IsHook(resource) || !isTrackedBy(resource, app.Name, config) {
+			continue
+		}
+		keys = append(keys, key)
+		lives = append(lives, resource)
+		targets = append(targets, nil)
+	}
+
+	diffConfig, err := argodiff.NewDiffConfigBuilder().
+		WithDiffSettings(app.Spec.IgnoreDifferences, config.overrides, config.ignoreAggregatedRoles,
+			normalizers.IgnoreNormalizerOpts{}).
+		WithTracking(config.labelKey, string(config.method)).
+		WithNoCache().
+		Build()
+	if err != nil {
+		return appDiff, err
+	}
+	results, err := argodiff.StateDiffs(lives, targets, diffConfig)
+	if err != nil {
+		return appDiff, err
+	}
+
+	for i, result := range results.Diffs {
+		resourceDiff, err := liveResourceDiff(keys[i], lives[i], targets[i], result.Modified,
+			result.NormalizedLive, result.PredictedLive)
+		if err != nil {
+			return appDiff, err
+		}
+		if resourceDiff == nil {
+			continue
+		}
+		if resourceDiff.Change == ChangeRemoved {
+			resourceDiff.IgnoreExtraneous = resourceutil.HasAnnotationOption(lives[i], common.AnnotationCompareOptions,
+				compareOptionIgnoreExtraneous)
+			resourceDiff.PruneDisabled = resourceutil.HasAnnotationOption(lives[i], synccommon.AnnotationSyncOptions,
+				synccommon.SyncOptionDisablePrune)
+		}
+		appDiff.Resources = append(appDiff.Resources, *resourceDiff)
+		if !resourceDiff.IgnoreExtraneous {
+			appDiff.Change = ChangeModified
+		}
+	}
+	sort.Slice(appDiff.Resources, func(i, j int) bool {
+		return compareKeysByName(appDiff.Resources[i].Key, appDiff.Resources[j].Key) < 0
+	})
+	return appDiff, nil
+}
+
+// isTrackedBy returns true if the tracking annotation, or the legacy tracking label, of a live resource
+// refers to the given Application
+func isTrackedBy(resource *unstructured.Unstructured, appName string, config liveDiffConfig) bool {
+	resourceTracking := argo.NewResourceTracking()
+	key := config.labelKey
+	return resourceTracking.GetAppName(resource, key, argo.TrackingMethodAnnotation, config.installationID) == appName ||
+		resourceTracking.GetAppName(resource, key, argo.TrackingMethodLabel, "") == appName
+}
+
+// liveResourceDiff returns the difference between the live and desired state of a resource,
+// or nil if the resource is in sync
+func liveResourceDiff(
+	key kube.ResourceKey,
+	live, target *unstructured.Unstructured,
+	modified bool,
+	normalizedLive, predictedLive []byte,
+) (*ResourceDiff, error) {
+	var change ChangeType
+	var from, to string
+	var err error
+
+	switch {
+	case live == nil:
+		change = ChangeAdded
+		to, err = marshalResource(target)
+	case target == nil:
+		change = ChangeRemoved
+		from, err = marshalResource(live)
+	case modified:
+		change = ChangeModified
+		from, to, err = jsonToYAMLPair(normalizedLive, predictedLive)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := unifiedDiff(key, from, to, "live", "desired")
+	if err != nil {
+		return nil, err
+	}
+	return &ResourceDiff{Key: key, Change: change, Diff: diff}, nil
+}
+
+// jsonToYAMLPair converts the normalized JSON states computed by the diff into YAML
+func jsonToYAMLPair(from, to []byte) (string, string, error) {
+	fromYAML, err := yaml.JSONToYAML(from)
+	if err != nil {
+		return "", "", err
+	}
+	toYAML, err := yaml.JSONToYAML(to)
+	if err != nil {
+		return "", "", err
+	}
+	return string(fromYAML), string(toYAML), nil
+}
+
+// PreviewApplicationLiveDiff renders an Application manifest and outputs its differences with a live state snapshot,
+// followed by the resources rendered more than once, which are returned
+func PreviewApplicationLiveDiff(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	filename string,
+	liveFile string,
+	filter ResourceFilter,
+	output string,
+	maxDiffLines int,
+) []DuplicateResource {
+	return generateAndOutputLiveDiff(
+		ctx, w, opts, filename, loadApplicationsFile, liveFile, AppFilter{}, filter, output, maxDiffLines)
+}
+
+// PreviewLiveDiff renders an ApplicationSet manifest and outputs its differences with a live state snapshot,
+// followed by the resources rendered more than once, which are returned
+func PreviewLiveDiff(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	filename string,
+	liveFile string,
+	appFilter AppFilter,
+	filter ResourceFilter,
+	output string,
+	maxDiffLines int,
+) []DuplicateResource {
+	return generateAndOutputLiveDiff(
+		ctx, w, opts, filename, expandApplicationSetFile, liveFile, appFilter, filter, output, maxDiffLines)
+}
+
+// generateAndOutputLiveDiff renders the Applications of a manifest file and outputs their sync status
+// against a live state snapshot, followed by the diff of every OutOfSync resource and the duplicate resources
+func generateAndOutputLiveDiff(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	filename string,
+	load applicationsLoader,
+	liveFile string,
+	appFilter AppFilter,
+	filter ResourceFilter,
+	output string,
+	maxDiffLines int,
+) []DuplicateResource {
+	errors.CheckError(checkDiffFormat(output))
+	appsMatcher := appFilter.mustCompile()
+	matcher := filter.mustCompile()
+
+	live, err := LoadLiveState(liveFile)
+	errors.CheckError(err)
+	filteredLive := make([]*unstructured.Unstructured, 0, len(live))
+	for _, resource := range live {
+		if matcher.matches(resource) {
+			filteredLive = append(filteredLive, resource)
+		}
+	}
+
+	renderer, err := NewRenderer(opts)
+	errors.CheckError(err)
+	defer renderer.Close()
+	apps, err := load(ctx, renderer, filename)
+	errors.CheckError(err)
+
+	selected := appsMatcher.selectApplications(apps)
+
+	rendered, duplicates, err := renderer.RenderApplicationsWithDuplicates(ctx, selected)
+	errors.CheckError(err)
+
+	diffs := make([]ApplicationDiff, 0, len(selected))
+	for i, resources := range rendered {
+		desired := make([]*unstructured.Unstructured, 0, len(resources))
+		for _, resource := range resources {
+			if matcher.matches(resource) {
+				desired = append(desired, resource)
+			}
+		}
+		appLive := make([]*unstructured.Unstructured, 0, len(filteredLive))
+		for _, resource := range filteredLive {
+			// Argo CD does not watch the excluded resources, so they are not part of its live state
+			if !opts.Settings.isExcluded(resource, destinationCluster(selected[i])) {
+				appLive = append(appLive, resource)
+			}
+		}
+		appDiff, err := DiffLive(selected[i], desired, appLive, renderer.liveSettings())
+		errors.CheckError(err)
+		diffs = append(diffs, appDiff)
+	}
+	report := ReportOptions{
+		Title:        fmt.Sprintf("Diff of %s with live state %s", filepath.Base(filename), filepath.Base(liveFile)),
+		MaxDiffLines: maxDiffLines,
+		Duplicates:   duplicates,
+	}
+	errors.CheckError(writeDiffReport(w, diffs, output, report, writeLiveDiff))
+	return duplicates
+}
+
+// writeLiveDiff writes the sync status of each Application and of its differing resources,
+// followed by the resource diffs
+func writeLiveDiff(w io.Writer, diffs []ApplicationDiff) error {
+	for _, appDiff := range diffs {
+		status := "OutOfSync"
+		if appDiff.Change == "" {
+			status = "Synced"
+		}
+		if _, err := fmt.Fprintf(w, "===== Application %s: %s =====\n", appDiff.Name, status); err != nil {
+			return err
+		}
+		if len(appDiff.Resources) == 0 {
+			continue
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "GROUP\tKIND\tNAMESPACE\tNAME\tSTATUS\tMESSAGE")
+		for _, resourceDiff := range appDiff.Resources {
+			key := resourceDiff.Key
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				key.Group, key.Kind, key.Namespace, key.Name, liveSyncStatus(resourceDiff), liveStatusMessage(resourceDiff))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		for _, resourceDiff := range appDiff.Resources {
+			if _, err := fmt.Fprint(w, resourceDiff.Diff); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// liveSyncStatus returns the sync status of a differing resource: OutOfSync, unless it only requires pruning
+// and its IgnoreExtraneous compare option keeps it from counting in the sync status
+func liveSyncStatus(resourceDiff ResourceDiff) string {
+	if resourceDiff.Change == ChangeRemoved && resourceDiff.IgnoreExtraneous {
+		return "Synced"
+	}
+	return "OutOfSync"
+}
+
+// liveStatusMessage describes why a resource is OutOfSync, as shown in the Argo CD UI,
+// noting the options Argo CD ignores a resource requiring pruning for
+func liveStatusMessage(resourceDiff ResourceDiff) string {
+	switch resourceDiff.Change {
+	case ChangeAdded:
+		return "Missing"
+	case ChangeRemoved:
+		var ignored []string
+		if resourceDiff.IgnoreExtraneous {
+			ignored = append(ignored, compareOptionIgnoreExtraneous)
+		}
+		if resourceDiff.PruneDisabled {
+			ignored = append(ignored, synccommon.SyncOptionDisablePrune)
+		}
+		if len(ignored) > 0 {
+			return fmt.Sprintf("Requires pruning, ignored (%s)", strings.Join(ignored, ", "))
+		}
+		return "Requires pruning"
+	default:
+		return ""
+	}
+}
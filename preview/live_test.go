@@ -0,0 +1,158 @@
+package preview
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+)
+
+const liveStateList = `apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: settings
+    namespace: prod
+    resourceVersion: "123"
+    uid: 0b1c2d
+    managedFields:
+    - manager: argocd-controller
+      operation: Apply
+    annotations:
+      argocd.argoproj.io/tracking-id: web:/ConfigMap:prod/settings
+  data:
+    mode: fast
+- apiVersion: apps/v1
+  kind: Deployment
+  metadata:
+    name: web
+    namespace: prod
+    annotations:
+      argocd.argoproj.io/tracking-id: web:apps/Deployment:prod/web
+  spec:
+    replicas: 5
+    progressDeadlineSeconds: 600
+  status:
+    replicas: 5
+- apiVersion: v1
+  kind: Service
+  metadata:
+    name: old
+    namespace: prod
+    labels:
+      app.kubernetes.io/instance: web
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: unrelated
+  namespace: prod
+`
+
+// TestLoadLiveState verifies that List objects and multi-document files are both expanded
+func TestLoadLiveState(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "live.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(liveStateList), 0o600))
+
+	live, err := LoadLiveState(filename)
+	require.NoError(t, err)
+	require.Len(t, live, 4)
+	require.Equal(t, "settings", live[0].GetName())
+	require.Equal(t, "unrelated", live[3].GetName())
+}
+
+// TestDiffLive verifies that normalized live resources are compared with the desired state:
+// defaulted and server-side fields are ignored, ignoreDifferences is applied, missing resources
+// are reported and tracked resources that are no longer desired require pruning
+func TestDiffLive(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "live.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(liveStateList), 0o600))
+	live, err := LoadLiveState(filename)
+	require.NoError(t, err)
+
+	app := argoappv1.Application{}
+	app.Name = "web"
+	app.Spec.Destination.Namespace = "prod"
+	desired := mustParseManifests(t,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings"},"data":{"mode":"fast"}}`,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"prod"},"spec":{"replicas":3}}`,
+		`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"token","namespace":"prod"}}`,
+		`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"migrate","namespace":"prod",`+
+			`"annotations":{"argocd.argoproj.io/hook":"PreSync"}}}`,
+	)
+
+	appDiff, err := DiffLive(app, desired, live, nil)
+	require.NoError(t, err)
+	require.Equal(t, ChangeModified, appDiff.Change)
+	require.Len(t, appDiff.Resources, 3)
+
+	require.Equal(t, "/Service/prod/old", appDiff.Resources[0].Key.String())
+	require.Equal(t, ChangeRemoved, appDiff.Resources[0].Change)
+	require.Equal(t, "/Secret/prod/token", appDiff.Resources[1].Key.String())
+	require.Equal(t, ChangeAdded, appDiff.Resources[1].Change)
+	require.Equal(t, "apps/Deployment/prod/web", appDiff.Resources[2].Key.String())
+	require.Equal(t, ChangeModified, appDiff.Resources[2].Change)
+	require.Contains(t, appDiff.Resources[2].Diff, "-  replicas: 5\n+  replicas: 3\n")
+	require.NotContains(t, appDiff.Resources[2].Diff, "-  progressDeadlineSeconds",
+		"defaulted fields are not a difference")
+
+	// Ignoring the replicas makes the Deployment Synced
+	app.Spec.IgnoreDifferences = argoappv1.IgnoreDifferences{
+		{Group: "apps", Kind: "Deployment", JSONPointers: []string{"/spec/replicas"}},
+	}
+	appDiff, err = DiffLive(app, desired[:2], live[:2], nil)
+	require.NoError(t, err)
+	require.Empty(t, appDiff.Resources)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeLiveDiff(&buf, []ApplicationDiff{appDiff}))
+	require.Equal(t, "===== Application web: Synced =====\n", buf.String())
+}
+
+// TestDiffLiveExtraneousOptions verifies that resources requiring pruning honour the IgnoreExtraneous
+// compare option and the Prune=false sync option
+func TestDiffLiveExtraneousOptions(t *testing.T) {
+	app := argoappv1.Application{}
+	app.Name = "web"
+	live := mustParseManifests(t,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cache","namespace":"prod",`+
+			`"annotations":{"argocd.argoproj.io/tracking-id":"web:/ConfigMap:prod/cache",`+
+			`"argocd.argoproj.io/compare-options":"IgnoreExtraneous"}}}`,
+	)
+
+	appDiff, err := DiffLive(app, nil, live, nil)
+	require.NoError(t, err)
+	require.Empty(t, appDiff.Change, "ignored extraneous resources do not make the Application OutOfSync")
+	require.Len(t, appDiff.Resources, 1)
+	require.True(t, appDiff.Resources[0].IgnoreExtraneous)
+
+	var buf bytes.Buffer
+	require.NoError(t, writeLiveDiff(&buf, []ApplicationDiff{appDiff}))
+	require.Contains(t, buf.String(), "===== Application web: Synced =====\n")
+	require.Regexp(t, `cache +Synced +Requires pruning, ignored \(IgnoreExtraneous\)`, buf.String())
+	require.NotContains(t, buf.String(), "OutOfSync")
+
+	live = append(live, mustParseManifests(t,
+		`{"apiVersion":"v1","kind":"PersistentVolumeClaim","metadata":{"name":"data","namespace":"prod",`+
+			`"annotations":{"argocd.argoproj.io/tracking-id":"web:/PersistentVolumeClaim:prod/data",`+
+			`"argocd.argoproj.io/sync-options":"Prune=false"}}}`,
+	)...)
+	appDiff, err = DiffLive(app, nil, live, nil)
+	require.NoError(t, err)
+	require.Equal(t, ChangeModified, appDiff.Change)
+	require.Len(t, appDiff.Resources, 2)
+	require.Equal(t, "/ConfigMap/prod/cache", appDiff.Resources[0].Key.String())
+	require.Equal(t, "/PersistentVolumeClaim/prod/data", appDiff.Resources[1].Key.String())
+	require.True(t, appDiff.Resources[1].PruneDisabled)
+
+	buf.Reset()
+	require.NoError(t, writeLiveDiff(&buf, []ApplicationDiff{appDiff}))
+	require.Contains(t, buf.String(), "===== Application web: OutOfSync =====\n")
+	require.Regexp(t, `cache +Synced +Requires pruning, ignored \(IgnoreExtraneous\)`, buf.String())
+	require.Regexp(t, `data +OutOfSync +Requires pruning, ignored \(Prune=false\)`, buf.String())
+}
@@ -0,0 +1,37 @@
+package preview
+
+import (
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	log "github.com/sirupsen/logrus"
+)
+
+// injectDestinationNamespace sets the namespace of the rendered resources the way Argo CD applies them:
+// namespaced resources without a namespace are placed in the destination namespace, and the namespace of
+// cluster-scoped resources is dropped. It warns about the namespaced resources targeting another namespace than
+// the destination one, and about the cluster-scoped resources carrying a namespace.
+func injectDestinationNamespace(app argoappv1.Application, sources renderedSources) {
+	resources := sources.flatten()
+	scopes := newResourceScopes(resources)
+	destination := app.Spec.Destination.Namespace
+	for _, resource := range resources {
+		namespace := resource.GetNamespace()
+		if !scopes.isNamespaced(resource.GroupVersionKind().GroupKind()) {
+			if namespace != "" {
+				key := kube.GetResourceKey(resource)
+				log.Warnf("Application %s: cluster-scoped resource %s has namespace %s, which is ignored",
+					app.Name, key.String(), namespace)
+				resource.SetNamespace("")
+			}
+			continue
+		}
+		switch {
+		case namespace == "":
+			resource.SetNamespace(destination)
+		case destination != "" && namespace != destination:
+			key := kube.GetResourceKey(resource)
+			log.Warnf("Application %s: resource %s targets another namespace than the destination namespace %s",
+				app.Name, key.String(), destination)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package preview
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestInjectDestinationNamespace verifies that resources are placed in namespaces the way Argo CD applies them
+func TestInjectDestinationNamespace(t *testing.T) {
+	sources := renderedSources{
+		mustParseManifests(t,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings"}}`,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"shared","namespace":"other"}}`,
+			`{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"ClusterRole","metadata":{"name":"reader","namespace":"x"}}`,
+		),
+		mustParseManifests(t,
+			`{"apiVersion":"apiextensions.k8s.io/v1","kind":"CustomResourceDefinition","metadata":{"name":"widgets.example.com"},
+			"spec":{"group":"example.com","names":{"kind":"Widget"},"scope":"Cluster"}}`,
+			`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"w","namespace":"prod"}}`,
+			`{"apiVersion":"example.com/v1","kind":"Gadget","metadata":{"name":"g"}}`,
+		),
+	}
+
+	injectDestinationNamespace(newDestinationApp("web", "prod"), sources)
+	var namespaces []string
+	for _, resource := range sources.flatten() {
+		namespaces = append(namespaces, resource.GetNamespace())
+	}
+	require.Equal(t, []string{"prod", "other", "", "", "", "prod"}, namespaces)
+}
@@ -0,0 +1,240 @@
+package preview
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/argoproj/gitops-engine/pkg/sync/common"
+	"github.com/argoproj/gitops-engine/pkg/sync/hook"
+	"github.com/argoproj/gitops-engine/pkg/sync/syncwaves"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ResourceOrder is the order rendered resources are output in
+type ResourceOrder string
+
+const (
+	// OrderKind groups resources by kind alphabetically, keeping the rendering order within a kind
+	OrderKind ResourceOrder = "kind"
+	// OrderSync sorts resources in the order Argo CD applies them: sync phase, sync wave, kind, then name
+	OrderSync ResourceOrder = "sync"
+	// OrderName sorts resources by name, then namespace, kind and group
+	OrderName ResourceOrder = "name"
+)
+
+// validate returns an error if the order is not supported
+func (o ResourceOrder) validate() error {
+	switch o {
+	case OrderKind, OrderSync, OrderName:
+		return nil
+	default:
+		return fmt.Errorf("unknown resource order '%s', expected one of: kind, sync, name", o)
+	}
+}
+
+// syncPhaseOrder is the order of the sync phases, as defined by gitops-engine.
+// Resources that are not applied, such as hooks of other types or skipped resources, come last.
+var syncPhaseOrder = map[common.SyncPhase]int{
+	common.SyncPhasePreSync:  -1,
+	common.SyncPhaseSync:     0,
+	common.SyncPhasePostSync: 1,
+	common.SyncPhaseSyncFail: 2,
+}
+
+// notSyncedPhaseOrder is the order of the resources that are not applied in any sync phase
+const notSyncedPhaseOrder = 3
+
+// kindOrder is the order gitops-engine applies the kinds of a same phase and wave in, kinds that are not listed
+// (e.g. custom resources) coming last. gitops-engine keeps it unexported, so it is copied here.
+// https://github.com/helm/helm/blob/0361dc85689e3a6d802c444e2540c92cb5842bc9/pkg/releaseutil/kind_sorter.go
+var kindOrder = map[string]int{}
+
+func init() {
+	kinds := []string{
+		"Namespace",
+		"NetworkPolicy",
+		"ResourceQuota",
+		"LimitRange",
+		"PodSecurityPolicy",
+		"PodDisruptionBudget",
+		"ServiceAccount",
+		"Secret",
+		"SecretList",
+		"ConfigMap",
+		"StorageClass",
+		"PersistentVolume",
+		"PersistentVolumeClaim",
+		"CustomResourceDefinition",
+		"ClusterRole",
+		"ClusterRoleList",
+		"ClusterRoleBinding",
+		"ClusterRoleBindingList",
+		"Role",
+		"RoleList",
+		"RoleBinding",
+		"RoleBindingList",
+		"Service",
+		"DaemonSet",
+		"Pod",
+		"ReplicationController",
+		"ReplicaSet",
+		"Deployment",
+		"HorizontalPodAutoscaler",
+		"StatefulSet",
+		"Job",
+		"CronJob",
+		"IngressClass",
+		"Ingress",
+		"APIService",
+	}
+	for i, kind := range kinds {
+		// Unlisted kinds get the zero value, after every listed kind
+		kindOrder[kind] = i - len(kinds)
+	}
+}
+
+// syncPhases returns the phases a resource is applied in: its hook phases for a hook,
+// the Sync phase for a regular resource, and none for a skipped resource
+func syncPhases(resource *unstructured.Unstructured) []common.SyncPhase {
+	if hook.Skip(resource) {
+		return nil
+	}
+	if !hook.IsHook(resource) {
+		return []common.SyncPhase{common.SyncPhaseSync}
+	}
+	var phases []common.SyncPhase
+	for _, hookType := range hook.Types(resource) {
+		phase := common.SyncPhase(hookType)
+		if _, ok := syncPhaseOrder[phase]; ok && !slices.Contains(phases, phase) {
+			phases = append(phases, phase)
+		}
+	}
+	sort.Slice(phases, func(i, j int) bool { return syncPhaseOrder[phases[i]] < syncPhaseOrder[phases[j]] })
+	return phases
+}
+
+// syncStep is a resource applied in a given sync phase and wave
+type syncStep struct {
+	resource *unstructured.Unstructured
+	// phase is empty for a resource that is not applied
+	phase common.SyncPhase
+	wave  int
+}
+
+// phaseOrder returns the position of the step phase in the sync
+func (s syncStep) phaseOrder() int {
+	if s.phase == "" {
+		return notSyncedPhaseOrder
+	}
+	return syncPhaseOrder[s.phase]
+}
+
+// lessSyncStep orders steps by phase, wave, kind and name, like gitops-engine does
+func lessSyncStep(a, b syncStep) bool {
+	if d := a.phaseOrder() - b.phaseOrder(); d != 0 {
+		return d < 0
+	}
+	if d := a.wave - b.wave; d != 0 {
+		return d < 0
+	}
+	if d := kindOrder[a.resource.GetKind()] - kindOrder[b.resource.GetKind()]; d != 0 {
+		return d < 0
+	}
+	return a.resource.GetName() < b.resource.GetName()
+}
+
+// sortSyncSteps sorts steps in the order Argo CD applies them, moving namespaces before the resources
+// they contain and CRDs before their custom resources, like gitops-engine does
+func sortSyncSteps(steps []syncStep) {
+	sort.SliceStable(steps, func(i, j int) bool { return lessSyncStep(steps[i], steps[j]) })
+
+	adjustSyncDependencies(steps, func(obj *unstructured.Unstructured) (string, bool) {
+		return obj.GetName(), obj.GetKind() == kube.NamespaceKind && obj.GroupVersionKind().Group == ""
+	}, func(obj *unstructured.Unstructured) (string, bool) {
+		return obj.GetNamespace(), obj.GetNamespace() != ""
+	})
+	adjustSyncDependencies(steps, func(obj *unstructured.Unstructured) (string, bool) {
+		if !kube.IsCRD(obj) {
+			return "", false
+		}
+		group, _, _ := unstructured.NestedString(obj.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(obj.Object, "spec", "names", "kind")
+		return group + "/" + kind, group != "" && kind != ""
+	}, func(obj *unstructured.Unstructured) (string, bool) {
+		gvk := obj.GroupVersionKind()
+		return gvk.Group + "/" + gvk.Kind, true
+	})
+}
+
+// adjustSyncDependencies moves each dependency (e.g. a namespace) right before the first step referencing it,
+// in the same phase and wave
+func adjustSyncDependencies(
+	steps []syncStep,
+	isDependency func(obj *unstructured.Unstructured) (string, bool),
+	referencesDependency func(obj *unstructured.Unstructured) (string, bool),
+) {
+	firstIndexByKey := map[string]int{}
+	for i := range steps {
+		step := steps[i]
+		if key, ok := isDependency(step.resource); ok {
+			index, referenced := firstIndexByKey[key]
+			if !referenced {
+				continue
+			}
+			step.phase = steps[index].phase
+			step.wave = steps[index].wave
+			copy(steps[index+1:i+1], steps[index:i])
+			steps[index] = step
+			for k, firstIndex := range firstIndexByKey {
+				if firstIndex >= index {
+					firstIndexByKey[k] = firstIndex + 1
+				}
+			}
+		} else if key, ok := referencesDependency(step.resource); ok {
+			if _, found := firstIndexByKey[key]; !found {
+				firstIndexByKey[key] = i
+			}
+		}
+	}
+}
+
+// sortResources sorts resources in the given order
+func sortResources(resources []*unstructured.Unstructured, order ResourceOrder) {
+	switch order {
+	case OrderSync:
+		steps := make([]syncStep, len(resources))
+		for i, resource := range resources {
+			steps[i] = syncStep{resource: resource, wave: syncwaves.Wave(resource)}
+			// A hook running in several phases is listed once, in its first phase
+			if phases := syncPhases(resource); len(phases) > 0 {
+				steps[i].phase = phases[0]
+			}
+		}
+		sortSyncSteps(steps)
+		for i, step := range steps {
+			resources[i] = step.resource
+		}
+	case OrderName:
+		sort.SliceStable(resources, func(i, j int) bool {
+			return compareKeysByName(kube.GetResourceKey(resources[i]), kube.GetResourceKey(resources[j])) < 0
+		})
+	default:
+		sort.SliceStable(resources, func(i, j int) bool {
+			return strings.ToLower(resources[i].GetKind()) < strings.ToLower(resources[j].GetKind())
+		})
+	}
+}
+
+// compareKeysByName compares resource keys by name, then namespace, kind and group
+func compareKeysByName(a, b kube.ResourceKey) int {
+	return cmp.Or(
+		cmp.Compare(a.Name, b.Name),
+		cmp.Compare(a.Namespace, b.Namespace),
+		cmp.Compare(a.Kind, b.Kind),
+		cmp.Compare(a.Group, b.Group),
+	)
+}
@@ -0,0 +1,94 @@
+package preview
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// resourceNames returns the kind/name of each resource
+func resourceNames(resources []*unstructured.Unstructured) []string {
+	names := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		names = append(names, resource.GetKind()+"/"+resource.GetName())
+	}
+	return names
+}
+
+// testOrderResources returns resources covering hooks, waves, namespaces and custom resources
+func testOrderResources(t *testing.T) []*unstructured.Unstructured {
+	return mustParseManifests(t,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"app"}}`,
+		`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"smoke-test",`+
+			`"annotations":{"argocd.argoproj.io/hook":"PostSync"}}}`,
+		`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"gadget","namespace":"app"}}`,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"late","namespace":"app",`+
+			`"annotations":{"argocd.argoproj.io/sync-wave":"5"}}}`,
+		`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"migrate",`+
+			`"annotations":{"argocd.argoproj.io/hook":"PreSync,PostSync"}}}`,
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","namespace":"app"}}`,
+		`{"apiVersion":"apiextensions.k8s.io/v1","kind":"CustomResourceDefinition","metadata":{"name":"widgets.example.com",`+
+			`"annotations":{"argocd.argoproj.io/sync-wave":"2"}},`+
+			`"spec":{"group":"example.com","names":{"kind":"Widget"}}}`,
+		`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"app",`+
+			`"annotations":{"argocd.argoproj.io/sync-wave":"1"}}}`,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"ignored",`+
+			`"annotations":{"argocd.argoproj.io/hook":"Skip"}}}`,
+	)
+}
+
+// TestSortResourcesSync verifies the Argo CD sync order: phase, wave, kind, name and dependencies
+func TestSortResourcesSync(t *testing.T) {
+	resources := testOrderResources(t)
+	sortResources(resources, OrderSync)
+	require.Equal(t, []string{
+		"Job/migrate",
+		// The namespace is moved before the first resource it contains, in wave 0
+		"Namespace/app",
+		"Service/web",
+		"Deployment/web",
+		// The CRD is moved before its custom resources
+		"CustomResourceDefinition/widgets.example.com",
+		"Widget/gadget",
+		"ConfigMap/late",
+		"Job/smoke-test",
+		"ConfigMap/ignored",
+	}, resourceNames(resources))
+}
+
+// TestSortResourcesByName verifies the ordering by name, then namespace, kind and group
+func TestSortResourcesByName(t *testing.T) {
+	resources := testOrderResources(t)
+	sortResources(resources, OrderName)
+	require.Equal(t, []string{
+		"Namespace/app",
+		"Widget/gadget",
+		"ConfigMap/ignored",
+		"ConfigMap/late",
+		"Job/migrate",
+		"Job/smoke-test",
+		"Deployment/web",
+		"Service/web",
+		"CustomResourceDefinition/widgets.example.com",
+	}, resourceNames(resources))
+}
+
+// TestSortResourcesByKind verifies that resources are grouped by kind, keeping the rendering order within a kind
+func TestSortResourcesByKind(t *testing.T) {
+	resources := testOrderResources(t)
+	sortResources(resources, OrderKind)
+	require.Equal(t, []string{
+		"ConfigMap/late",
+		"ConfigMap/ignored",
+		"CustomResourceDefinition/widgets.example.com",
+		"Deployment/web",
+		"Job/smoke-test",
+		"Job/migrate",
+		"Namespace/app",
+		"Service/web",
+		"Widget/gadget",
+	}, resourceNames(resources))
+
+	require.ErrorContains(t, ResourceOrder("random").validate(), "unknown resource order")
+}
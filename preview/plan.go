@@ -0,0 +1,90 @@
+package preview
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/argoproj/gitops-engine/pkg/sync/common"
+	"github.com/argoproj/gitops-engine/pkg/sync/hook"
+	"github.com/argoproj/gitops-engine/pkg/sync/syncwaves"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// outputFormatPlan prints the sync plan of the rendered resources
+const outputFormatPlan = "plan"
+
+// planStep is a step of the sync plan of an Application
+type planStep struct {
+	appName string
+	syncStep
+}
+
+// syncPlan returns the steps Argo CD would go through to sync the resources of an Application:
+// a hook is listed in each of its phases, and skipped resources come last
+func syncPlan(appName string, resources []*unstructured.Unstructured) []planStep {
+	var steps []syncStep
+	for _, resource := range resources {
+		wave := syncwaves.Wave(resource)
+		phases := syncPhases(resource)
+		if len(phases) == 0 {
+			steps = append(steps, syncStep{resource: resource, wave: wave})
+			continue
+		}
+		for _, phase := range phases {
+			steps = append(steps, syncStep{resource: resource, phase: phase, wave: wave})
+		}
+	}
+	sortSyncSteps(steps)
+
+	plan := make([]planStep, 0, len(steps))
+	for _, step := range steps {
+		plan = append(plan, planStep{appName: appName, syncStep: step})
+	}
+	return plan
+}
+
+// printSyncPlan prints the sync plan steps as a table, with the hook types and delete policies of the hooks
+func printSyncPlan(w io.Writer, steps []planStep) error {
+	tw := newTableWriter(w)
+	fmt.Fprintln(tw, "APP\tPHASE\tWAVE\tKIND\tNAMESPACE\tNAME\tHOOK\tDELETE-POLICY")
+	for _, step := range steps {
+		resource := step.resource
+		phase, wave := "-", "-"
+		if step.phase != "" {
+			phase, wave = string(step.phase), strconv.Itoa(step.wave)
+		}
+		fmt.Fprintln(tw, strings.Join([]string{
+			step.appName, phase, wave, resource.GetKind(), resource.GetNamespace(), resource.GetName(),
+			planHookTypes(resource), deletePolicies(resource),
+		}, "\t"))
+	}
+	return tw.Flush()
+}
+
+// planHookTypes returns the hook types of a resource, Skip for a skipped resource
+func planHookTypes(resource *unstructured.Unstructured) string {
+	if hook.Skip(resource) {
+		return string(common.HookTypeSkip)
+	}
+	return hookTypes(resource)
+}
+
+// deletePolicies returns the sorted, comma separated delete policies of a hook, or an empty string if it is not a hook.
+// Hooks without a delete policy default to BeforeHookCreation, like Argo CD does.
+func deletePolicies(resource *unstructured.Unstructured) string {
+	if !hook.IsHook(resource) {
+		return ""
+	}
+	var names []string
+	for _, policy := range hook.DeletePolicies(resource) {
+		if name := string(policy); !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
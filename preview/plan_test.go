@@ -0,0 +1,42 @@
+package preview
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestPrintSyncPlan verifies that resources are grouped by phase and wave, hooks being listed in each of their phases
+func TestPrintSyncPlan(t *testing.T) {
+	resources := mustParseManifests(t,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"prod"}}`,
+		`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"migrate","annotations":{`+
+			`"argocd.argoproj.io/hook":"PreSync,PostSync",`+
+			`"argocd.argoproj.io/hook-delete-policy":"HookSucceeded,BeforeHookCreation"}}}`,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings","namespace":"prod",`+
+			`"annotations":{"argocd.argoproj.io/sync-wave":"-1"}}}`,
+		`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"notify",`+
+			`"annotations":{"argocd.argoproj.io/hook":"SyncFail"}}}`,
+		`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"seed",`+
+			`"annotations":{"helm.sh/hook":"post-install","helm.sh/hook-weight":"5",`+
+			`"helm.sh/hook-delete-policy":"hook-succeeded"}}}`,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"draft",`+
+			`"annotations":{"argocd.argoproj.io/hook":"Skip"}}}`,
+	)
+
+	var buf bytes.Buffer
+	require.NoError(t, printSyncPlan(&buf, syncPlan("guestbook", resources)))
+	require.Equal(t,
+		"APP         PHASE      WAVE   KIND         NAMESPACE   NAME       HOOK               DELETE-POLICY\n"+
+			"guestbook   PreSync    0      Job                      migrate    PostSync,PreSync   "+
+			"BeforeHookCreation,HookSucceeded\n"+
+			"guestbook   Sync       -1     ConfigMap    prod        settings                      \n"+
+			"guestbook   Sync       0      Deployment   prod        web                           \n"+
+			"guestbook   PostSync   0      Job                      migrate    PostSync,PreSync   "+
+			"BeforeHookCreation,HookSucceeded\n"+
+			"guestbook   PostSync   5      Job                      seed       PostSync           HookSucceeded\n"+
+			"guestbook   SyncFail   0      Job                      notify     SyncFail           BeforeHookCreation\n"+
+			"guestbook   -          -      ConfigMap                draft      Skip               \n",
+		buf.String())
+}
@@ -0,0 +1,142 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	cmpapiclient "github.com/argoproj/argo-cd/v3/cmpserver/apiclient"
+	"github.com/argoproj/argo-cd/v3/cmpserver/plugin"
+	"github.com/argoproj/argo-cd/v3/common"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// PluginConfig is a Config Management Plugin definition, the plugin.yaml of an Argo CD plugin sidecar
+type PluginConfig = plugin.PluginConfig
+
+// LoadPluginConfigs reads the Config Management Plugin definitions of a file: either a plugin.yaml,
+// or a ConfigMap holding plugin.yaml files in its data, the way they are usually mounted into the sidecars
+func LoadPluginConfigs(filename string) ([]PluginConfig, error) {
+	data, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plugin %s: %w", filename, err)
+	}
+	var configMap corev1.ConfigMap
+	if err := yaml.Unmarshal(data, &configMap); err != nil {
+		return nil, fmt.Errorf("failed to parse plugin %s: %w", filename, err)
+	}
+	if configMap.Kind != "ConfigMap" {
+		config, err := parsePluginConfig(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid plugin %s: %w", filename, err)
+		}
+		return []PluginConfig{*config}, nil
+	}
+
+	var configs []PluginConfig
+	for key, value := range configMap.Data {
+		config, err := parsePluginConfig([]byte(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid plugin %s in ConfigMap %s: %w", key, filename, err)
+		}
+		configs = append(configs, *config)
+	}
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("no plugin found in ConfigMap %s", filename)
+	}
+	return configs, nil
+}
+
+// parsePluginConfig parses and validates a plugin.yaml
+func parsePluginConfig(data []byte) (*PluginConfig, error) {
+	var config PluginConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	if err := plugin.ValidatePluginConfig(config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// pluginServers runs Config Management Plugins locally, each one served on a Unix socket by the same service
+// that runs in the Argo CD plugin sidecars. The repo service finds the sockets through the
+// ARGOCD_PLUGINSOCKFILEPATH environment variable, which is process-wide: only the plugins of the last Renderer
+// created with plugins are available.
+type pluginServers struct {
+	dir       string
+	servers   []*grpc.Server
+	closeOnce sync.Once
+}
+
+// startPluginServers starts serving the plugins, from a new temporary directory
+func startPluginServers(configs []PluginConfig) (*pluginServers, error) {
+	dir, err := os.MkdirTemp("", "argocd-cmp-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the plugin directory: %w", err)
+	}
+	s := &pluginServers{dir: dir}
+	if err := os.Setenv(common.EnvPluginSockFilePath, dir); err != nil {
+		s.close()
+		return nil, err
+	}
+	if err := os.Setenv(common.EnvCMPWorkDir, dir); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	for _, config := range configs {
+		if err := s.start(config); err != nil {
+			s.close()
+			return nil, fmt.Errorf("failed to start plugin %s: %w", config.Metadata.Name, err)
+		}
+	}
+	return s, nil
+}
+
+// start serves a plugin on its socket, named after the plugin name and version like the sidecars do
+func (s *pluginServers) start(config PluginConfig) error {
+	service := plugin.NewService(plugin.CMPServerInitConstants{PluginConfig: config})
+	if err := service.Init(common.GetCMPWorkDir()); err != nil {
+		return err
+	}
+	listener, err := net.Listen("unix", config.Address())
+	if err != nil {
+		return err
+	}
+
+	server := grpc.NewServer(
+		grpc.MaxRecvMsgSize(cmpapiclient.MaxGRPCMessageSize),
+		grpc.MaxSendMsgSize(cmpapiclient.MaxGRPCMessageSize),
+	)
+	cmpapiclient.RegisterConfigManagementPluginServiceServer(server, service)
+	s.servers = append(s.servers, server)
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Warnf("Plugin %s stopped: %v", config.Metadata.Name, err)
+		}
+	}()
+	log.Debugf("Serving plugin %s on %s", config.Metadata.Name, config.Address())
+	return nil
+}
+
+// close stops the plugins and removes their sockets and work directories
+func (s *pluginServers) close() {
+	if s == nil {
+		return
+	}
+	s.closeOnce.Do(func() {
+		for _, server := range s.servers {
+			server.Stop()
+		}
+		if err := os.RemoveAll(s.dir); err != nil {
+			log.Warnf("Failed to remove plugin directory %s: %v", s.dir, err)
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package preview
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	cmpapiclient "github.com/argoproj/argo-cd/v3/cmpserver/apiclient"
+	"github.com/argoproj/argo-cd/v3/common"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const pluginConfig = `apiVersion: argoproj.io/v1alpha1
+kind: ConfigManagementPlugin
+metadata:
+  name: envsubst
+spec:
+  version: v1.0
+  generate:
+    command: [sh, -c, "envsubst < template.yaml"]
+  discover:
+    fileName: template.yaml
+`
+
+const pluginConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: cmp-plugins
+data:
+  plugin.yaml: |
+    apiVersion: argoproj.io/v1alpha1
+    kind: ConfigManagementPlugin
+    metadata:
+      name: sops
+    spec:
+      generate:
+        command: [sh, -c, "sops -d secrets.yaml"]
+`
+
+// writePluginConfig writes a plugin definition to a temporary file
+func writePluginConfig(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "plugin.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0o600))
+	return filename
+}
+
+func TestLoadPluginConfigs(t *testing.T) {
+	configs, err := LoadPluginConfigs(writePluginConfig(t, pluginConfig))
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	require.Equal(t, "envsubst", configs[0].Metadata.Name)
+	require.Equal(t, "template.yaml", configs[0].Spec.Discover.FileName)
+
+	configs, err = LoadPluginConfigs(writePluginConfig(t, pluginConfigMap))
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	require.Equal(t, "sops", configs[0].Metadata.Name)
+	require.False(t, configs[0].Spec.Discover.IsDefined())
+
+	_, err = LoadPluginConfigs(writePluginConfig(t, "apiVersion: argoproj.io/v1alpha1\nkind: ConfigManagementPlugin\n"))
+	require.ErrorContains(t, err, "metadata.name should be non-empty")
+
+	_, err = LoadPluginConfigs(writePluginConfig(t, "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: empty\n"))
+	require.ErrorContains(t, err, "no plugin found")
+}
+
+// TestPluginServers verifies that the plugins are served where the repo service looks for them,
+// and that closing the Renderer removes them
+func TestPluginServers(t *testing.T) {
+	t.Setenv(common.EnvPluginSockFilePath, "")
+	t.Setenv(common.EnvCMPWorkDir, "")
+	configs, err := LoadPluginConfigs(writePluginConfig(t, pluginConfig))
+	require.NoError(t, err)
+
+	renderer := newTestRenderer(t, Options{Plugins: configs})
+	dir := os.Getenv(common.EnvPluginSockFilePath)
+	address := filepath.Join(dir, "envsubst-v1.0.sock")
+	require.FileExists(t, address)
+
+	conn, client, err := cmpapiclient.NewConfigManagementPluginClientSet(address).NewConfigManagementPluginClient()
+	require.NoError(t, err)
+	response, err := client.CheckPluginConfiguration(context.Background(), &emptypb.Empty{})
+	require.NoError(t, err)
+	require.True(t, response.IsDiscoveryConfigured)
+	require.NoError(t, conn.Close())
+
+	renderer.Close()
+	require.NoDirExists(t, dir)
+	renderer.Close()
+}
+
+const discoveredPluginConfig = `apiVersion: argoproj.io/v1alpha1
+kind: ConfigManagementPlugin
+metadata:
+  name: env-configmap
+spec:
+  init:
+    command: [sh, -c, "echo initialized > init.txt"]
+  generate:
+    command:
+    - sh
+    - -c
+    - |
+      printf 'apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: %s\ndata:\n  x: %s\n  init: %s\n' \
+        "$ARGOCD_APP_NAME" "$ARGOCD_ENV_X" "$(cat init.txt)"
+  discover:
+    fileName: marker.txt
+`
+
+// TestRenderPluginApplication verifies that an Application source using a plugin is rendered by the plugin
+// discovered by its file name, running its init and generate commands with the Application environment
+func TestRenderPluginApplication(t *testing.T) {
+	t.Setenv(common.EnvPluginSockFilePath, "")
+	t.Setenv(common.EnvCMPWorkDir, "")
+	configs, err := LoadPluginConfigs(writePluginConfig(t, discoveredPluginConfig))
+	require.NoError(t, err)
+
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"},
+			args...)...)
+		output, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	git("init", "-q")
+	require.NoError(t, os.MkdirAll(filepath.Join(repo, "config"), 0o750))
+	require.NoError(t, os.WriteFile(filepath.Join(repo, "config", "marker.txt"), []byte("marker"), 0o600))
+	git("add", ".")
+	git("commit", "-q", "-m", "plugin")
+
+	app := newDestinationApp("web", "prod")
+	app.Spec.Source = &argoappv1.ApplicationSource{
+		RepoURL:        "file://" + repo,
+		Path:           "config",
+		TargetRevision: "HEAD",
+		Plugin: &argoappv1.ApplicationSourcePlugin{
+			Env: argoappv1.Env{{Name: "X", Value: "hello"}},
+		},
+	}
+
+	renderer := newTestRenderer(t, Options{Plugins: configs})
+	defer renderer.Close()
+	resources, err := renderer.RenderApplication(context.Background(), app)
+	require.NoError(t, err)
+	require.Len(t, resources, 1)
+	require.Equal(t, "ConfigMap", resources[0].GetKind())
+	require.Equal(t, "web", resources[0].GetName())
+	data, _, err := unstructured.NestedStringMap(resources[0].Object, "data")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"x": "hello", "init": "initialized"}, data)
+}
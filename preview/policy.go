@@ -0,0 +1,352 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	errorsutil "github.com/argoproj/pkg/errors"
+	"github.com/google/cel-go/cel"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+)
+
+// Severity levels of the policy rules
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+)
+
+// Variables of the policy rule expressions
+const (
+	celVariableObject      = "object"
+	celVariableApplication = "application"
+)
+
+// PolicyMatch selects the resources a policy rule applies to, like ResourceFilter does
+type PolicyMatch struct {
+	Kind        string   `json:"kind,omitempty"`
+	Group       string   `json:"group,omitempty"`
+	Namespace   string   `json:"namespace,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Selector    string   `json:"selector,omitempty"`
+	Annotations []string `json:"annotations,omitempty"`
+}
+
+// PolicyRule is a rule the rendered resources must follow, written in CEL. The expressions see the resource
+// as object and its Application as application.
+type PolicyRule struct {
+	// Name identifies the rule in the reports
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Severity is one of error (the default), warning or info
+	Severity string      `json:"severity,omitempty"`
+	Match    PolicyMatch `json:"match,omitempty"`
+	// Condition is an optional expression restricting the resources the rule applies to
+	Condition string `json:"condition,omitempty"`
+	// Expression must evaluate to true for the resource to follow the rule
+	Expression string `json:"expression"`
+	// Message describes a violation of the rule, unless MessageExpression is set
+	Message           string `json:"message,omitempty"`
+	MessageExpression string `json:"messageExpression,omitempty"`
+}
+
+// PolicyOptions holds the policies the rendered resources are checked against
+type PolicyOptions struct {
+	// Rules are the compiled policy rules, as returned by LoadPolicyRules or CompilePolicyRules.
+	// Their names must be unique.
+	Rules []*CompiledPolicyRule
+	// AdmissionPolicies are ValidatingAdmissionPolicies and bindings, along with the resources they may take
+	// as parameters, as returned by LoadAdmissionPolicies or CompileAdmissionPolicies. Those rendered are
+	// checked as well.
+	AdmissionPolicies []*AdmissionPolicies
+}
+
+// policyFile is the content of a policy file
+type policyFile struct {
+	Rules []PolicyRule `json:"rules"`
+}
+
+// LoadPolicyRules loads and compiles the policy rules of a file
+func LoadPolicyRules(filename string) ([]*CompiledPolicyRule, error) {
+	data, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy %s: %w", filename, err)
+	}
+	var policy policyFile
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy %s: %w", filename, err)
+	}
+	if len(policy.Rules) == 0 {
+		return nil, fmt.Errorf("no rule found in policy %s", filename)
+	}
+	compiled, err := CompilePolicyRules(policy.Rules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %s: %w", filename, err)
+	}
+	return compiled, nil
+}
+
+// CompiledPolicyRule is a policy rule with its expressions compiled, ready to be evaluated.
+// It is built by LoadPolicyRules or CompilePolicyRules.
+type CompiledPolicyRule struct {
+	rule       PolicyRule
+	severity   string
+	matcher    *resourceMatcher
+	condition  cel.Program
+	expression cel.Program
+	message    cel.Program
+}
+
+// Rule returns the policy rule that was compiled
+func (c *CompiledPolicyRule) Rule() PolicyRule {
+	return c.rule
+}
+
+// CompilePolicyRules validates the rules and compiles their expressions
+func CompilePolicyRules(rules []PolicyRule) ([]*CompiledPolicyRule, error) {
+	env, err := newCELEnv(celVariableObject, celVariableApplication)
+	if err != nil {
+		return nil, err
+	}
+	compiled := make([]*CompiledPolicyRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("rule without a name")
+		}
+		c, err := compilePolicyRule(env, rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		compiled = append(compiled, c)
+	}
+	if err := checkCompiledRules(compiled); err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// checkCompiledRules returns an error if a rule was not built by CompilePolicyRules,
+// or if several rules share the same name
+func checkCompiledRules(rules []*CompiledPolicyRule) error {
+	names := map[string]bool{}
+	for _, rule := range rules {
+		if rule == nil || rule.matcher == nil || rule.expression == nil {
+			return fmt.Errorf("policy rule not compiled with CompilePolicyRules")
+		}
+		if names[rule.rule.Name] {
+			return fmt.Errorf("duplicate rule %s", rule.rule.Name)
+		}
+		names[rule.rule.Name] = true
+	}
+	return nil
+}
+
+// compilePolicyRule compiles the expressions and the resource filter of a rule
+func compilePolicyRule(env *cel.Env, rule PolicyRule) (*CompiledPolicyRule, error) {
+	c := &CompiledPolicyRule{rule: rule, severity: rule.Severity}
+	switch rule.Severity {
+	case "":
+		c.severity = SeverityError
+	case SeverityError, SeverityWarning, SeverityInfo:
+	default:
+		return nil, fmt.Errorf("unknown severity '%s', expected one of: error, warning, info", rule.Severity)
+	}
+	if rule.Expression == "" {
+		return nil, fmt.Errorf("no expression")
+	}
+
+	var err error
+	filter := ResourceFilter(rule.Match)
+	if c.matcher, err = filter.compile(); err != nil {
+		return nil, err
+	}
+	if rule.Condition != "" {
+		if c.condition, err = compileCEL(env, rule.Condition, cel.BoolType); err != nil {
+			return nil, err
+		}
+	}
+	if c.expression, err = compileCEL(env, rule.Expression, cel.BoolType); err != nil {
+		return nil, err
+	}
+	if rule.MessageExpression != "" {
+		if c.message, err = compileCEL(env, rule.MessageExpression, cel.StringType); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// evaluate returns the violation message if the resource does not follow the rule, or an empty string.
+// An expression failing to evaluate is a violation.
+func (c *CompiledPolicyRule) evaluate(vars map[string]any) string {
+	if c.condition != nil {
+		applies, err := evalBool(c.condition, vars)
+		if err != nil {
+			return "condition evaluation failed: " + err.Error()
+		}
+		if !applies {
+			return ""
+		}
+	}
+	valid, err := evalBool(c.expression, vars)
+	if err != nil {
+		return "expression evaluation failed: " + err.Error()
+	}
+	if valid {
+		return ""
+	}
+	return failureMessage(c.message, c.rule.Message, c.rule.Expression, vars)
+}
+
+// policyViolation is a rendered resource not following a policy
+type policyViolation struct {
+	appName  string
+	resource *unstructured.Unstructured
+	policy   string
+	severity string
+	message  string
+}
+
+// policyResult holds the policy violations of the rendered resources
+type policyResult struct {
+	violations []policyViolation
+	// checked counts the resources checked, rules the rules they were checked against
+	checked, rules int
+}
+
+// count returns the number of violations of a severity
+func (r policyResult) count(severity string) int {
+	count := 0
+	for _, violation := range r.violations {
+		if violation.severity == severity {
+			count++
+		}
+	}
+	return count
+}
+
+// CheckApplicationPolicies renders an Application manifest and evaluates the policies against the resources,
+// returning false if any of them violates a rule of the error severity or a denying admission policy
+func CheckApplicationPolicies(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	policies PolicyOptions,
+	filename string,
+	filter ResourceFilter,
+) bool {
+	return generateAndCheckPolicies(ctx, w, opts, policies, filename, loadApplicationsFile, AppFilter{}, filter)
+}
+
+// CheckPolicies renders an ApplicationSet manifest and evaluates the policies against the resources,
+// returning false if any of them violates a rule of the error severity or a denying admission policy
+func CheckPolicies(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	policies PolicyOptions,
+	filename string,
+	appFilter AppFilter,
+	filter ResourceFilter,
+) bool {
+	return generateAndCheckPolicies(ctx, w, opts, policies, filename, expandApplicationSetFile, appFilter, filter)
+}
+
+// generateAndCheckPolicies renders the Applications of a manifest file and outputs the policy violations
+// by Application and resource
+func generateAndCheckPolicies(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	policies PolicyOptions,
+	filename string,
+	load applicationsLoader,
+	appFilter AppFilter,
+	filter ResourceFilter,
+) bool {
+	appsMatcher := appFilter.mustCompile()
+	matcher := filter.mustCompile()
+	errorsutil.CheckError(checkCompiledRules(policies.Rules))
+
+	renderer, err := NewRenderer(opts)
+	errorsutil.CheckError(err)
+	defer renderer.Close()
+	apps, err := load(ctx, renderer, filename)
+	errorsutil.CheckError(err)
+	selected := appsMatcher.selectApplications(apps)
+	rendered, err := renderer.RenderApplications(ctx, selected)
+	errorsutil.CheckError(err)
+
+	admission, err := newAdmissionChecker(policies.AdmissionPolicies, selected, rendered)
+	errorsutil.CheckError(err)
+	result, err := checkPolicyRules(policies.Rules, admission, selected, rendered, matcher)
+	errorsutil.CheckError(err)
+	errorsutil.CheckError(printPolicyResult(w, result))
+	return result.count(SeverityError) == 0
+}
+
+// checkPolicyRules evaluates the rules and the admission policies against the resources of each Application
+// selected by the matcher
+func checkPolicyRules(
+	rules []*CompiledPolicyRule,
+	admission *admissionChecker,
+	apps []argoappv1.Application,
+	rendered [][]*unstructured.Unstructured,
+	matcher *resourceMatcher,
+) (policyResult, error) {
+	result := policyResult{rules: len(rules) + admission.count()}
+	for i, resources := range rendered {
+		application, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&apps[i])
+		if err != nil {
+			return result, err
+		}
+		resources = selectResources(resources, matcher)
+		sortResources(resources, OrderName)
+		for _, resource := range resources {
+			result.checked++
+			vars := map[string]any{celVariableObject: resource.Object, celVariableApplication: application}
+			for _, rule := range rules {
+				if !rule.matcher.matches(resource) {
+					continue
+				}
+				if message := rule.evaluate(vars); message != "" {
+					result.violations = append(result.violations, policyViolation{
+						appName: apps[i].Name, resource: resource, policy: rule.rule.Name,
+						severity: rule.severity, message: message,
+					})
+				}
+			}
+			result.violations = append(result.violations, admission.check(apps[i], resource)...)
+		}
+	}
+	return result, nil
+}
+
+// printPolicyResult prints the policy violations as a table, followed by a summary
+func printPolicyResult(w io.Writer, result policyResult) error {
+	if len(result.violations) > 0 {
+		tw := newTableWriter(w)
+		fmt.Fprintln(tw, "APP\tKIND\tNAMESPACE\tNAME\tPOLICY\tSEVERITY\tMESSAGE")
+		for _, v := range result.violations {
+			fmt.Fprintln(tw, strings.Join([]string{
+				v.appName, v.resource.GetKind(), v.resource.GetNamespace(), v.resource.GetName(),
+				v.policy, v.severity, v.message,
+			}, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	_, err := fmt.Fprintf(w, "%d resource(s) checked against %d rule(s): %d error(s), %d warning(s), %d info\n",
+		result.checked, result.rules, result.count(SeverityError), result.count(SeverityWarning),
+		result.count(SeverityInfo))
+	return err
+}
@@ -0,0 +1,144 @@
+package preview
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const policyRules = `rules:
+- name: resource-limits
+  match:
+    kind: deploy,sts
+  expression: object.spec.template.spec.containers.all(c, has(c.resources) && has(c.resources.limits))
+  messageExpression: "'containers of ' + object.metadata.name + ' have no resource limits'"
+- name: no-docker-hub
+  severity: warning
+  match:
+    kind: deploy
+  expression: "!object.spec.template.spec.containers.exists(c, c.image.startsWith('docker.io/'))"
+  message: images must not be pulled from docker.io
+- name: team-label
+  severity: info
+  condition: application.metadata.?labels.team.hasValue()
+  expression: object.metadata.?labels.team.orValue('') == application.metadata.labels.team
+- name: replicas
+  match:
+    kind: deploy
+  expression: object.spec.replicas >= 2
+`
+
+// writePolicy writes policy rules to a temporary file
+func writePolicy(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0o600))
+	return filename
+}
+
+func TestLoadPolicyRules(t *testing.T) {
+	rules, err := LoadPolicyRules(writePolicy(t, policyRules))
+	require.NoError(t, err)
+	require.Len(t, rules, 4)
+	require.Equal(t, "deploy,sts", rules[0].Rule().Match.Kind)
+	require.EqualError(t, checkCompiledRules(append(rules, rules[0])), "duplicate rule "+rules[0].Rule().Name,
+		"the rule names are unique across files too")
+	require.EqualError(t, checkCompiledRules([]*CompiledPolicyRule{{}}),
+		"policy rule not compiled with CompilePolicyRules")
+
+	for _, tc := range []struct{ content, expected string }{
+		{"rules: []\n", "no rule found"},
+		{"rules:\n- expression: 'true'\n", "rule without a name"},
+		{"rules:\n- name: a\n  expresion: 'true'\n", "unknown field"},
+		{"rules:\n- name: a\n", "rule a: no expression"},
+		{"rules:\n- name: a\n  expression: object.(\n", "rule a: invalid expression"},
+		{"rules:\n- name: a\n  expression: '\"yes\"'\n", "must evaluate to a bool"},
+		{"rules:\n- name: a\n  severity: fatal\n  expression: 'true'\n", "unknown severity 'fatal'"},
+		{"rules:\n- name: a\n  expression: 'true'\n- name: a\n  expression: 'true'\n", "duplicate rule a"},
+	} {
+		_, err := LoadPolicyRules(writePolicy(t, tc.content))
+		require.ErrorContains(t, err, tc.expected, tc.content)
+	}
+}
+
+// TestCheckPolicyRules verifies that the rules are evaluated against the resources they match
+func TestCheckPolicyRules(t *testing.T) {
+	rules, err := LoadPolicyRules(writePolicy(t, policyRules))
+	require.NoError(t, err)
+
+	apps := []argoappv1.Application{
+		{ObjectMeta: metav1.ObjectMeta{Name: "web", Labels: map[string]string{"team": "a"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "db"}},
+	}
+	rendered := [][]*unstructured.Unstructured{
+		mustParseManifests(t,
+			`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","labels":{"team":"a"}},
+			"spec":{"replicas":3,"template":{"spec":{"containers":[
+				{"image":"docker.io/nginx","resources":{"limits":{}}}
+			]}}}}`,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings"}}`,
+		),
+		mustParseManifests(t,
+			`{"apiVersion":"apps/v1","kind":"StatefulSet","metadata":{"name":"db"},
+			"spec":{"template":{"spec":{"containers":[{"image":"postgres"}]}}}}`,
+			`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"proxy"},
+			"spec":{"template":{"spec":{"containers":[{"image":"envoy","resources":{"limits":{}}}]}}}}`,
+		),
+	}
+
+	admission, err := newAdmissionChecker(nil, apps, rendered)
+	require.NoError(t, err)
+	result, err := checkPolicyRules(rules, admission, apps, rendered, mustCompileFilter(t, ResourceFilter{}))
+	require.NoError(t, err)
+	var violations []string
+	for _, v := range result.violations {
+		violations = append(violations, strings.Join([]string{v.appName, v.resource.GetName(), v.policy, v.severity,
+			v.message}, " | "))
+	}
+	require.Equal(t, []string{
+		"web | settings | team-label | info | failed expression: " +
+			"object.metadata.?labels.team.orValue('') == application.metadata.labels.team",
+		"web | web | no-docker-hub | warning | images must not be pulled from docker.io",
+		"db | db | resource-limits | error | containers of db have no resource limits",
+		"db | proxy | replicas | error | expression evaluation failed: no such key: replicas",
+	}, violations)
+
+	var buf bytes.Buffer
+	require.NoError(t, printPolicyResult(&buf, result))
+	require.True(t, strings.HasPrefix(buf.String(), "APP   KIND          NAMESPACE   NAME       POLICY"))
+	require.True(t, strings.HasSuffix(buf.String(),
+		"\n\n4 resource(s) checked against 4 rule(s): 2 error(s), 1 warning(s), 1 info\n"))
+}
+
+// TestCompilePolicyRules verifies that rules built in memory are compiled and evaluated like the loaded ones
+func TestCompilePolicyRules(t *testing.T) {
+	rules, err := CompilePolicyRules([]PolicyRule{{
+		Name:       "named-ports",
+		Match:      PolicyMatch{Kind: "Service"},
+		Expression: "object.spec.ports.all(p, has(p.name))",
+		Message:    "ports must be named",
+	}})
+	require.NoError(t, err)
+	require.Equal(t, "named-ports", rules[0].Rule().Name)
+
+	apps := []argoappv1.Application{{ObjectMeta: metav1.ObjectMeta{Name: "web"}}}
+	rendered := [][]*unstructured.Unstructured{mustParseManifests(t,
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"},"spec":{"ports":[{"port":80}]}}`,
+	)}
+	admission, err := newAdmissionChecker(nil, apps, rendered)
+	require.NoError(t, err)
+	result, err := checkPolicyRules(rules, admission, apps, rendered, mustCompileFilter(t, ResourceFilter{}))
+	require.NoError(t, err)
+	require.Len(t, result.violations, 1)
+	require.Equal(t, "ports must be named", result.violations[0].message)
+
+	_, err = CompilePolicyRules([]PolicyRule{{Name: "a"}})
+	require.EqualError(t, err, "rule a: no expression")
+}
@@ -0,0 +1,140 @@
+package preview
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/kubectl/pkg/cmd/get"
+	"sigs.k8s.io/yaml"
+)
+
+// Template output format prefixes
+const (
+	outputFormatJSONPathPrefix      = "jsonpath="
+	outputFormatGoTemplatePrefix    = "go-template="
+	outputFormatCustomColumnsPrefix = "custom-columns="
+)
+
+// printResource writes a single resource in JSON or YAML format
+// Mirrors argocmd.PrintResource, which can only write to stdout
+func printResource(w io.Writer, resource any, output string) error {
+	switch output {
+	case outputFormatJSON:
+		jsonBytes, err := json.MarshalIndent(resource, "", "  ")
+		if err != nil {
+			return fmt.Errorf("unable to marshal resource to json: %w", err)
+		}
+		_, err = fmt.Fprintln(w, string(jsonBytes))
+		return err
+	case outputFormatYAML:
+		yamlBytes, err := yaml.Marshal(resource)
+		if err != nil {
+			return fmt.Errorf("unable to marshal resource to yaml: %w", err)
+		}
+		_, err = fmt.Fprint(w, string(yamlBytes))
+		return err
+	default:
+		return fmt.Errorf("unknown output format: %s", output)
+	}
+}
+
+// printResourceList writes a list of resources in JSON or YAML format
+// Mirrors argocmd.PrintResourceList, which can only write to stdout
+func printResourceList(w io.Writer, resources any, output string) error {
+	// If we have a zero len list, prevent printing "null"
+	kt := reflect.ValueOf(resources)
+	if (kt.Kind() == reflect.Slice || kt.Kind() == reflect.Array) && kt.Len() == 0 {
+		return printResource(w, []string{}, output)
+	}
+	return printResource(w, resources, output)
+}
+
+// isTemplateOutput returns true if the output format is a jsonpath, go-template or custom-columns template
+func isTemplateOutput(output string) bool {
+	return strings.HasPrefix(output, outputFormatJSONPathPrefix) ||
+		strings.HasPrefix(output, outputFormatGoTemplatePrefix) ||
+		strings.HasPrefix(output, outputFormatCustomColumnsPrefix)
+}
+
+// newTemplatePrinter returns the kubectl printer of a jsonpath, go-template or custom-columns output format.
+// Like kubectl, missing keys are printed as empty values rather than failing.
+func newTemplatePrinter(output string) (printers.ResourcePrinter, error) {
+	if tmpl, ok := strings.CutPrefix(output, outputFormatJSONPathPrefix); ok {
+		printer, err := printers.NewJSONPathPrinter(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("invalid jsonpath template: %w", err)
+		}
+		printer.AllowMissingKeys(true)
+		return printer, nil
+	}
+	if tmpl, ok := strings.CutPrefix(output, outputFormatGoTemplatePrefix); ok {
+		printer, err := printers.NewGoTemplatePrinter([]byte(tmpl))
+		if err != nil {
+			return nil, fmt.Errorf("invalid go-template: %w", err)
+		}
+		printer.AllowMissingKeys(true)
+		return printer, nil
+	}
+	if spec, ok := strings.CutPrefix(output, outputFormatCustomColumnsPrefix); ok {
+		printer, err := get.NewCustomColumnsPrinterFromSpec(spec, unstructured.UnstructuredJSONScheme, false)
+		if err != nil {
+			return nil, fmt.Errorf("invalid custom-columns spec: %w", err)
+		}
+		return printer, nil
+	}
+	return nil, fmt.Errorf("unknown output format: %s", output)
+}
+
+// printTemplated writes a single object with a jsonpath, go-template or custom-columns template
+func printTemplated(w io.Writer, object any, output string) error {
+	printer, err := newTemplatePrinter(output)
+	if err != nil {
+		return err
+	}
+	obj, err := toUnstructured(object)
+	if err != nil {
+		return err
+	}
+	return printer.PrintObj(obj, w)
+}
+
+// printTemplatedList writes a list of objects with a jsonpath, go-template or custom-columns template.
+// Like kubectl, the objects are wrapped in a List, e.g. {.items[*].metadata.name}.
+func printTemplatedList(w io.Writer, objects any, output string) error {
+	printer, err := newTemplatePrinter(output)
+	if err != nil {
+		return err
+	}
+
+	list := &unstructured.UnstructuredList{Object: map[string]any{"apiVersion": "v1", "kind": "List"}}
+	values := reflect.ValueOf(objects)
+	for i := range values.Len() {
+		obj, err := toUnstructured(values.Index(i).Interface())
+		if err != nil {
+			return err
+		}
+		list.Items = append(list.Items, *obj)
+	}
+	return printer.PrintObj(list, w)
+}
+
+// toUnstructured converts an object to its unstructured representation
+func toUnstructured(object any) (*unstructured.Unstructured, error) {
+	if obj, ok := object.(*unstructured.Unstructured); ok {
+		return obj, nil
+	}
+	data, err := json.Marshal(object)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal resource to json: %w", err)
+	}
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(data); err != nil {
+		return nil, fmt.Errorf("unable to convert resource: %w", err)
+	}
+	return obj, nil
+}
@@ -0,0 +1,100 @@
+package preview
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// TestPrintResourceList verifies the JSON and YAML output written to the writer
+func TestPrintResourceList(t *testing.T) {
+	resources := []map[string]string{{"name": "first"}}
+
+	var buf bytes.Buffer
+	require.NoError(t, printResourceList(&buf, resources, outputFormatYAML))
+	require.Equal(t, "- name: first\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, printResourceList(&buf, resources, outputFormatJSON))
+	require.Equal(t, "[\n  {\n    \"name\": \"first\"\n  }\n]\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, printResourceList(&buf, []map[string]string{}, outputFormatJSON))
+	require.Equal(t, "[]\n", buf.String(), "empty lists should not print null")
+
+	require.Error(t, printResourceList(&buf, resources, "xml"))
+}
+
+// TestPreviewApplicationNames verifies that Application names are written to the writer
+func TestPreviewApplicationNames(t *testing.T) {
+	var buf bytes.Buffer
+	PreviewApplication(&buf, "../testdata/test-app.yaml", AppFilter{}, outputFormatName)
+	require.Equal(t, "NAME\napplication/test-app\n", buf.String())
+
+	buf.Reset()
+	PreviewApplication(&buf, "../testdata/test-app.yaml", AppFilter{Names: []string{"test-app"}}, outputFormatYAML)
+	require.Contains(t, buf.String(), "kind: Application\n")
+	require.Contains(t, buf.String(), "name: test-app\n")
+}
+
+// TestPrintResources verifies the name output of rendered resources, grouped by kind
+func TestPrintResources(t *testing.T) {
+	manifests, err := parseManifests([]string{
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web"}}`,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web"}}`,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"config"}}`,
+	})
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	printResources(&buf, filterResources(manifests, mustCompileFilter(t, ResourceFilter{})), outputFormatName)
+	require.Equal(t,
+		"NAME\nconfigmap/config\n\nNAME\ndeployment/web\n\nNAME\nservice/web\n",
+		buf.String())
+
+	buf.Reset()
+	services := mustCompileFilter(t, ResourceFilter{Kind: "service"})
+	printResources(&buf, filterResources(manifests, services), outputFormatName)
+	require.Equal(t, "NAME\nservice/web\n", buf.String())
+
+	buf.Reset()
+	printResources(&buf, map[string][]unstructured.Unstructured{}, outputFormatYAML)
+	require.Empty(t, buf.String())
+}
+
+// TestPrintTemplatedList verifies the jsonpath, go-template and custom-columns output of a list of resources
+func TestPrintTemplatedList(t *testing.T) {
+	resources := mustParseManifests(t,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings","namespace":"prod"}}`,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web"}}`,
+	)
+
+	var buf bytes.Buffer
+	require.NoError(t, printTemplatedList(&buf, resources, `jsonpath={range .items[*]}{.kind}/{.metadata.name} {end}`))
+	require.Equal(t, "ConfigMap/settings Deployment/web ", buf.String())
+
+	buf.Reset()
+	require.NoError(t, printTemplatedList(&buf, resources, `go-template={{range .items}}{{.metadata.name}},{{end}}`))
+	require.Equal(t, "settings,web,", buf.String())
+
+	buf.Reset()
+	require.NoError(t, printTemplatedList(&buf, resources, "custom-columns=KIND:.kind,NAMESPACE:.metadata.namespace"))
+	require.Equal(t, "KIND         NAMESPACE\nConfigMap    prod\nDeployment   <none>\n", buf.String())
+
+	require.ErrorContains(t, printTemplatedList(&buf, resources, "jsonpath={.items["), "invalid jsonpath template")
+	require.ErrorContains(t, printTemplatedList(&buf, resources, "xml"), "unknown output format")
+}
+
+// TestPreviewApplicationTemplated verifies the template output of Applications, selected by name or not
+func TestPreviewApplicationTemplated(t *testing.T) {
+	var buf bytes.Buffer
+	testApp := AppFilter{Names: []string{"test-app"}}
+	PreviewApplication(&buf, "../testdata/test-app.yaml", testApp, "jsonpath={.kind}/{.metadata.name}")
+	require.Equal(t, "Application/test-app", buf.String())
+
+	buf.Reset()
+	PreviewApplication(&buf, "../testdata/test-app.yaml", AppFilter{}, "jsonpath={.items[*].metadata.name}")
+	require.Equal(t, "test-app", buf.String())
+}
@@ -0,0 +1,195 @@
+package preview
+
+import (
+	"errors"
+	"fmt"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	log "github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// In-cluster destination, known to Argo CD without being declared
+const (
+	inClusterServer = "https://kubernetes.default.svc"
+	inClusterName   = "in-cluster"
+)
+
+// LoadAppProjects loads the AppProjects of a manifest file. List objects are expanded into their items,
+// and objects of other kinds are ignored.
+func LoadAppProjects(filename string) ([]argoappv1.AppProject, error) {
+	manifests, err := loadManifestsFile(filename, "AppProjects")
+	if err != nil {
+		return nil, err
+	}
+
+	var projects []argoappv1.AppProject
+	for _, manifest := range manifests {
+		if manifest.GetKind() != appProjectKind {
+			continue
+		}
+		var project argoappv1.AppProject
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(manifest.Object, &project); err != nil {
+			return nil, fmt.Errorf("failed to parse AppProject %s: %w", manifest.GetName(), err)
+		}
+		projects = append(projects, project)
+	}
+	if len(projects) == 0 {
+		return nil, fmt.Errorf("no AppProject found in %s", filename)
+	}
+	return projects, nil
+}
+
+// applicationProject returns the AppProject of an Application, or nil when no AppProjects were loaded
+func (r *Renderer) applicationProject(app argoappv1.Application) (*argoappv1.AppProject, error) {
+	if r.opts.Projects == nil {
+		return nil, nil
+	}
+	for i := range r.opts.Projects {
+		if r.opts.Projects[i].Name == app.Spec.GetProject() {
+			return &r.opts.Projects[i], nil
+		}
+	}
+	if app.Spec.GetProject() == argoappv1.DefaultAppProjectName {
+		return defaultAppProject(), nil
+	}
+	return nil, fmt.Errorf("application '%s' references project %s which does not exist", app.Name, app.Spec.GetProject())
+}
+
+// defaultAppProject returns the default AppProject Argo CD creates when it is missing, which permits everything
+func defaultAppProject() *argoappv1.AppProject {
+	return &argoappv1.AppProject{
+		ObjectMeta: metav1.ObjectMeta{Name: argoappv1.DefaultAppProjectName, Namespace: argoCDNamespace},
+		Spec: argoappv1.AppProjectSpec{
+			SourceRepos:              []string{"*"},
+			Destinations:             []argoappv1.ApplicationDestination{{Server: "*", Name: "*", Namespace: "*"}},
+			ClusterResourceWhitelist: []metav1.GroupKind{{Group: "*", Kind: "*"}},
+		},
+	}
+}
+
+// destinationOf returns the destination cluster of an Application, completing the in-cluster destination
+// that can be referred to by name or by URL
+func destinationOf(app argoappv1.Application) *argoappv1.Cluster {
+	cluster := &argoappv1.Cluster{Server: app.Spec.Destination.Server, Name: app.Spec.Destination.Name}
+	switch {
+	case cluster.Server == inClusterServer && cluster.Name == "":
+		cluster.Name = inClusterName
+	case cluster.Name == inClusterName && cluster.Server == "":
+		cluster.Server = inClusterServer
+	}
+	return cluster
+}
+
+// destinationKey identifies the destination cluster of an Application: its server URL, or else its name
+func destinationKey(app argoappv1.Application) string {
+	destination := destinationOf(app)
+	if destination.Server != "" {
+		return destination.Server
+	}
+	return destination.Name
+}
+
+// permittedProject returns the AppProject to check an Application against. The clusters scoped to a project
+// are only known to the Argo CD server, so the restriction to them is lifted with a warning.
+func permittedProject(app argoappv1.Application, project *argoappv1.AppProject) *argoappv1.AppProject {
+	if !project.Spec.PermitOnlyProjectScopedClusters {
+		return project
+	}
+	log.Warnf("Application %s: project %s only permits project-scoped clusters, which cannot be checked offline",
+		app.Name, project.Name)
+	permitted := project.DeepCopy()
+	permitted.Spec.PermitOnlyProjectScopedClusters = false
+	return permitted
+}
+
+// noProjectClusters is used in place of the clusters scoped to a project, which are not known offline
+func noProjectClusters(_ string) ([]*argoappv1.Cluster, error) {
+	return nil, nil
+}
+
+// validateApplicationProject returns an error listing the reasons Argo CD would refuse to sync an Application
+// in its project: an Application namespace, a source or a destination that is not permitted
+func validateApplicationProject(app argoappv1.Application, project *argoappv1.AppProject) error {
+	project = permittedProject(app, project)
+	var violations []error
+	if !project.IsAppNamespacePermitted(&app, argoCDNamespace) {
+		violations = append(violations, fmt.Errorf("application namespace %s is not permitted", app.Namespace))
+	}
+	for _, source := range app.Spec.GetSources() {
+		if !project.IsSourcePermitted(source) {
+			violations = append(violations, fmt.Errorf("application repo %s is not permitted", source.RepoURL))
+		}
+	}
+	destination := destinationOf(app)
+	permitted, err := project.IsDestinationPermitted(destination, app.Spec.Destination.Namespace, noProjectClusters)
+	if err != nil {
+		return err
+	}
+	if !permitted {
+		violations = append(violations, fmt.Errorf(
+			"application destination server '%s' and namespace '%s' do not match any of the allowed destinations",
+			destination.Server, app.Spec.Destination.Namespace))
+	}
+	return projectViolations(app, project, violations)
+}
+
+// validateProjectResources returns an error listing the rendered resources of an Application that its project
+// does not permit: kinds denied by the cluster or namespace resource lists, or namespaces outside of the
+// allowed destinations
+func validateProjectResources(
+	app argoappv1.Application,
+	project *argoappv1.AppProject,
+	resources []*unstructured.Unstructured,
+) error {
+	project = permittedProject(app, project)
+	scopes := newResourceScopes(resources)
+	destination := destinationOf(app)
+	var violations []error
+	for _, resource := range resources {
+		gk := resource.GroupVersionKind().GroupKind()
+		namespaced := scopes.isNamespaced(gk)
+		if !project.IsGroupKindPermitted(gk, namespaced) {
+			scope := "cluster"
+			if namespaced {
+				scope = "namespace"
+			}
+			violations = append(violations, fmt.Errorf("%s-scoped resource %s:%s is not permitted",
+				scope, gk, resource.GetName()))
+			continue
+		}
+		if !namespaced {
+			continue
+		}
+		namespace := resource.GetNamespace()
+		if namespace == "" {
+			namespace = app.Spec.Destination.Namespace
+		}
+		if namespace == "" {
+			continue
+		}
+		permitted, err := project.IsDestinationPermitted(destination, namespace, noProjectClusters)
+		if err != nil {
+			return err
+		}
+		if !permitted {
+			key := kube.GetResourceKey(resource)
+			violations = append(violations, fmt.Errorf("namespace %s of resource %s is not permitted",
+				namespace, key.String()))
+		}
+	}
+	return projectViolations(app, project, violations)
+}
+
+// projectViolations joins the reasons an Application is not permitted by its project into a single error,
+// or returns nil if there are none
+func projectViolations(app argoappv1.Application, project *argoappv1.AppProject, violations []error) error {
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("application '%s' is not permitted in project '%s':\n%w",
+		app.Name, project.Name, errors.Join(violations...))
+}
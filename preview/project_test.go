@@ -0,0 +1,165 @@
+package preview
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const appProjects = `apiVersion: argoproj.io/v1alpha1
+kind: AppProject
+metadata:
+  name: team-a
+  namespace: argocd
+spec:
+  sourceRepos:
+  - https://github.com/example/team-a-*
+  sourceNamespaces:
+  - team-a-apps
+  destinations:
+  - server: https://kubernetes.default.svc
+    namespace: team-a-*
+  clusterResourceWhitelist:
+  - group: ""
+    kind: Namespace
+  namespaceResourceBlacklist:
+  - group: ""
+    kind: ResourceQuota
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+`
+
+// loadTestProjects loads the test AppProjects from a temporary file
+func loadTestProjects(t *testing.T) []argoappv1.AppProject {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "projects.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(appProjects), 0o600))
+	projects, err := LoadAppProjects(filename)
+	require.NoError(t, err)
+	return projects
+}
+
+// newProjectApp returns an Application of the team-a project
+func newProjectApp(repoURL string, namespace string) argoappv1.Application {
+	return argoappv1.Application{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: argoCDNamespace},
+		Spec: argoappv1.ApplicationSpec{
+			Project:     "team-a",
+			Source:      &argoappv1.ApplicationSource{RepoURL: repoURL, Path: "web"},
+			Destination: argoappv1.ApplicationDestination{Name: "in-cluster", Namespace: namespace},
+		},
+	}
+}
+
+func TestLoadAppProjects(t *testing.T) {
+	projects := loadTestProjects(t)
+	require.Len(t, projects, 1)
+	require.Equal(t, "team-a", projects[0].Name)
+	require.Equal(t, []string{"https://github.com/example/team-a-*"}, projects[0].Spec.SourceRepos)
+
+	filename := filepath.Join(t.TempDir(), "empty.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte("apiVersion: v1\nkind: ConfigMap\n"), 0o600))
+	_, err := LoadAppProjects(filename)
+	require.ErrorContains(t, err, "no AppProject found")
+}
+
+func TestValidateApplicationProject(t *testing.T) {
+	project := &loadTestProjects(t)[0]
+
+	app := newProjectApp("https://github.com/example/team-a-web", "team-a-web")
+	require.NoError(t, validateApplicationProject(app, project))
+
+	app.Spec.Destination = argoappv1.ApplicationDestination{Server: inClusterServer, Namespace: "team-a-web"}
+	require.NoError(t, validateApplicationProject(app, project))
+
+	app = newProjectApp("https://github.com/example/team-b-web", "team-b-web")
+	app.Namespace = "team-b-apps"
+	err := validateApplicationProject(app, project)
+	require.ErrorContains(t, err, "application 'web' is not permitted in project 'team-a'")
+	require.ErrorContains(t, err, "application namespace team-b-apps is not permitted")
+	require.ErrorContains(t, err, "application repo https://github.com/example/team-b-web is not permitted")
+	require.ErrorContains(t, err, "namespace 'team-b-web' do not match any of the allowed destinations")
+
+	app = newProjectApp("https://github.com/example/team-a-web", "team-a-web")
+	app.Namespace = "team-a-apps"
+	require.NoError(t, validateApplicationProject(app, project))
+}
+
+func TestValidateProjectResources(t *testing.T) {
+	project := &loadTestProjects(t)[0]
+	app := newProjectApp("https://github.com/example/team-a-web", "team-a-web")
+
+	resources := mustParseManifests(t,
+		`{"apiVersion":"v1","kind":"Namespace","metadata":{"name":"team-a-web"}}`,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings"}}`,
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","namespace":"team-a-web"}}`,
+	)
+	require.NoError(t, validateProjectResources(app, project, resources))
+
+	resources = mustParseManifests(t,
+		`{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"ClusterRole","metadata":{"name":"admin"}}`,
+		`{"apiVersion":"v1","kind":"ResourceQuota","metadata":{"name":"quota"}}`,
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","namespace":"kube-system"}}`,
+	)
+	err := validateProjectResources(app, project, resources)
+	require.ErrorContains(t, err, "cluster-scoped resource ClusterRole.rbac.authorization.k8s.io:admin is not permitted")
+	require.ErrorContains(t, err, "namespace-scoped resource ResourceQuota:quota is not permitted")
+	require.ErrorContains(t, err, "namespace kube-system of resource /Service/kube-system/web is not permitted")
+}
+
+// TestValidateProjectResourcesScope verifies that the scope of custom resources is read from their CRD
+func TestValidateProjectResourcesScope(t *testing.T) {
+	project := &loadTestProjects(t)[0]
+	app := newProjectApp("https://github.com/example/team-a-web", "team-a-web")
+
+	resources := mustParseManifests(t,
+		`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"widget"}}`,
+	)
+	require.NoError(t, validateProjectResources(app, project, resources))
+
+	resources = mustParseManifests(t,
+		`{"apiVersion":"apiextensions.k8s.io/v1","kind":"CustomResourceDefinition",`+
+			`"metadata":{"name":"widgets.example.com"},`+
+			`"spec":{"group":"example.com","scope":"Cluster","names":{"kind":"Widget","plural":"widgets"}}}`,
+		`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"widget"}}`,
+	)
+	err := validateProjectResources(app, project, resources)
+	require.ErrorContains(t, err, "CustomResourceDefinition.apiextensions.k8s.io:widgets.example.com is not permitted")
+	require.ErrorContains(t, err, "cluster-scoped resource Widget.example.com:widget is not permitted")
+}
+
+func TestRenderApplicationUnknownProject(t *testing.T) {
+	r := newTestRenderer(t, Options{Projects: loadTestProjects(t)})
+	app := newProjectApp("https://github.com/example/team-a-web", "team-a-web")
+	app.Spec.Project = "team-b"
+
+	_, err := r.RenderApplication(context.Background(), app)
+	require.EqualError(t, err, "application 'web' references project team-b which does not exist")
+
+	_, err = r.manifestRequest(app, app.Spec.Source, &argoappv1.Repository{Repo: app.Spec.Source.RepoURL})
+	require.EqualError(t, err, "application 'web' references project team-b which does not exist")
+}
+
+// TestApplicationDefaultProject verifies that the default project permits everything when it is not declared
+func TestApplicationDefaultProject(t *testing.T) {
+	r := newTestRenderer(t, Options{Projects: loadTestProjects(t)})
+	app := newProjectApp("https://github.com/example/other", "kube-system")
+	app.Spec.Project = ""
+
+	project, err := r.applicationProject(app)
+	require.NoError(t, err)
+	require.Equal(t, argoappv1.DefaultAppProjectName, project.Name)
+	require.NoError(t, validateApplicationProject(app, project))
+	resources := mustParseManifests(t,
+		`{"apiVersion":"rbac.authorization.k8s.io/v1","kind":"ClusterRole","metadata":{"name":"admin"}}`,
+	)
+	require.NoError(t, validateProjectResources(app, project, resources))
+}
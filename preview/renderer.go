@@ -0,0 +1,632 @@
+package preview
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	appsettemplate "github.com/argoproj/argo-cd/v3/applicationset/controllers/template"
+	appsetutils "github.com/argoproj/argo-cd/v3/applicationset/utils"
+	"github.com/argoproj/argo-cd/v3/common"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v3/reposerver/apiclient"
+	"github.com/argoproj/argo-cd/v3/reposerver/metrics"
+	"github.com/argoproj/argo-cd/v3/reposerver/repository"
+	"github.com/argoproj/argo-cd/v3/util/argo"
+	"github.com/argoproj/argo-cd/v3/util/git"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// CredentialsFunc returns the username and password used to access the given repository URL.
+type CredentialsFunc func(repoURL string) (username string, password string)
+
+// DefaultCredentials resolves repository credentials from the HELM_REPO_USERNAME and
+// HELM_REPO_PASSWORD environment variables, falling back to the local helm repository config.
+func DefaultCredentials(repoURL string) (string, string) {
+	return FindRepoUsername(repoURL), FindRepoPassword(repoURL)
+}
+
+// Options configures a Renderer
+type Options struct {
+	// CacheDir is where repositories and Helm charts are fetched to.
+	// Defaults to a directory inside the system temp directory.
+	CacheDir string
+	// Credentials resolves the credentials of remote repositories.
+	// Defaults to DefaultCredentials.
+	Credentials CredentialsFunc
+	// Parallelism is the maximum number of Applications rendered concurrently
+	// by RenderApplications. Defaults to 1.
+	Parallelism int
+	// AppTimeout bounds the time spent rendering a single Application.
+	// Zero means no per-Application timeout.
+	AppTimeout time.Duration
+	// LocalRevision is the revision that sources pointing to the local Git repository are rendered at.
+	// Defaults to HEAD.
+	LocalRevision string
+	// TrackingMethod is how the rendered resources are marked as part of their Application, as Argo CD does
+	// at sync time: annotation, label or annotation+label. Defaults to the tracking method of the Settings,
+	// if any. Empty means no tracking metadata is injected.
+	TrackingMethod string
+	// AppInstanceLabelKey is the label used by the label and annotation+label tracking methods.
+	// Defaults to the app instance label key of the Settings, if any, or else to app.kubernetes.io/instance.
+	AppInstanceLabelKey string
+	// Settings are the Argo CD settings the resources are rendered with, as the Argo CD server would.
+	// Resources excluded by the settings are dropped from the rendered resources. Nil means no settings.
+	Settings *ArgoCDSettings
+	// Projects are the AppProjects Applications are validated against, the way Argo CD refuses to sync
+	// an Application its project does not permit. Nil means no validation.
+	Projects []argoappv1.AppProject
+	// Capabilities are the Kubernetes version and API versions resources are rendered against, as the Argo CD
+	// server passes those of the destination cluster. Empty means the Helm defaults.
+	Capabilities Capabilities
+	// ClusterCapabilities override Capabilities for the destination clusters they are keyed by,
+	// a server URL or a cluster name.
+	ClusterCapabilities map[string]Capabilities
+	// Plugins are the Config Management Plugins run locally for the sources using a plugin, the way the Argo CD
+	// plugin sidecars run them. The Renderer must then be closed to stop them.
+	Plugins []PluginConfig
+	// InjectNamespace places the namespaced resources without a namespace in the destination namespace, and drops
+	// the namespace of cluster-scoped resources, as Argo CD does when applying them. False leaves them as rendered.
+	InjectNamespace bool
+}
+
+// Renderer expands ApplicationSets and renders the Kubernetes resources of Applications,
+// the same way the Argo CD ApplicationSet controller and repo server would.
+type Renderer struct {
+	opts        Options
+	repoService *repository.Service
+	// cachedEntries are the cache dir entries that existed before this Renderer was used
+	cachedEntries map[string]bool
+	plugins       *pluginServers
+	// generate calls the repo service to generate manifests
+	generate func(context.Context, *repoapiclient.ManifestRequest) (*repoapiclient.ManifestResponse, error)
+	// fetches tracks the repo service calls still running, which may still be writing to the cache dir
+	fetches sync.WaitGroup
+	// fetchGracePeriod bounds the wait for the running repo service calls before removing partial work
+	fetchGracePeriod time.Duration
+	// fetchedRepos records the repositories fetched by the repo service calls, by normalized URL, and whether
+	// one of the calls succeeded
+	fetchedRepos     map[string]bool
+	fetchedReposLock sync.Mutex
+}
+
+// defaultFetchGracePeriod is how long the repo service calls are waited for once cancelled
+const defaultFetchGracePeriod = 10 * time.Second
+
+// NewRenderer creates a Renderer and initializes its repo service
+func NewRenderer(opts Options) (*Renderer, error) {
+	if opts.CacheDir == "" {
+		opts.CacheDir = getCacheDir()
+	}
+	if opts.Credentials == nil {
+		opts.Credentials = DefaultCredentials
+	}
+	if opts.Parallelism < 1 {
+		opts.Parallelism = 1
+	}
+	if opts.LocalRevision == "" {
+		opts.LocalRevision = localRevisionHead
+	}
+	if opts.Settings != nil {
+		opts.TrackingMethod = cmp.Or(opts.TrackingMethod, opts.Settings.TrackingMethod)
+		opts.AppInstanceLabelKey = cmp.Or(opts.AppInstanceLabelKey, opts.Settings.AppInstanceLabelKey)
+	}
+	if opts.AppInstanceLabelKey == "" {
+		opts.AppInstanceLabelKey = common.LabelKeyAppInstance
+	}
+	if err := validateTrackingMethod(opts.TrackingMethod); err != nil {
+		return nil, err
+	}
+	if err := opts.Capabilities.validate(); err != nil {
+		return nil, err
+	}
+	for cluster, capabilities := range opts.ClusterCapabilities {
+		if err := capabilities.validate(); err != nil {
+			return nil, fmt.Errorf("cluster %s: %w", cluster, err)
+		}
+	}
+
+	max, err := resource.ParseQuantity("100G")
+	if err != nil {
+		return nil, err
+	}
+	maxValue := max.ToDec().Value()
+	initConstants := repository.RepoServerInitConstants{
+		HelmManifestMaxExtractedSize:      maxValue,
+		HelmRegistryMaxIndexSize:          maxValue,
+		MaxCombinedDirectoryManifestsSize: max,
+		StreamedManifestMaxExtractedSize:  maxValue,
+		StreamedManifestMaxTarSize:        maxValue,
+	}
+	if err := opts.Settings.applyRepoServerParams(&initConstants); err != nil {
+		return nil, err
+	}
+
+	repoService := repository.NewService(
+		metrics.NewMetricsServer(),
+		NewNoopCache(),
+		initConstants,
+		argo.NewResourceTracking(),
+		git.NoopCredsStore{},
+		opts.CacheDir,
+	)
+	if err := repoService.Init(); err != nil {
+		return nil, fmt.Errorf("failed to initialize the repo service: %w", err)
+	}
+
+	r := &Renderer{
+		opts:             opts,
+		repoService:      repoService,
+		generate:         repoService.GenerateManifest,
+		fetchGracePeriod: defaultFetchGracePeriod,
+		fetchedRepos:     map[string]bool{},
+	}
+	if r.cachedEntries, err = r.listCacheDir(); err != nil {
+		return nil, fmt.Errorf("failed to read the cache directory: %w", err)
+	}
+	if len(opts.Plugins) > 0 {
+		if r.plugins, err = startPluginServers(opts.Plugins); err != nil {
+			return nil, err
+		}
+		// The commands exit with log.Fatal on errors, skipping deferred calls
+		log.RegisterExitHandler(r.Close)
+	}
+	return r, nil
+}
+
+// Close stops the plugins run by the Renderer, if any
+func (r *Renderer) Close() {
+	r.plugins.close()
+}
+
+// ExpandApplicationSet generates the Applications of an ApplicationSet
+func (r *Renderer) ExpandApplicationSet(
+	ctx context.Context,
+	appSet *argoappv1.ApplicationSet,
+) ([]argoappv1.Application, error) {
+	return ExpandApplicationSet(ctx, appSet)
+}
+
+// ExpandApplicationSet generates the Applications of an ApplicationSet. The supported generators need no
+// repository, so no Renderer is needed either.
+func ExpandApplicationSet(ctx context.Context, appSet *argoappv1.ApplicationSet) ([]argoappv1.Application, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	apps, _, err := appsettemplate.GenerateApplications(
+		log.NewEntry(log.StandardLogger()),
+		*appSet,
+		getAppSetGenerators(),
+		&appsetutils.Render{},
+		nil,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate Application(s): %w", err)
+	}
+	return apps, nil
+}
+
+// manifestRequest returns the request generating the manifests of an Application source from the given
+// repository, carrying the settings the Argo CD server would generate them with
+func (r *Renderer) manifestRequest(
+	app argoappv1.Application,
+	source *argoappv1.ApplicationSource,
+	repo *argoappv1.Repository,
+) (*repoapiclient.ManifestRequest, error) {
+	capabilities := r.capabilities(app)
+	request := &repoapiclient.ManifestRequest{
+		ApplicationSource:  source,
+		AppName:            app.Name,
+		Namespace:          app.Spec.Destination.Namespace,
+		NoCache:            true,
+		HasMultipleSources: app.Spec.HasMultipleSources(),
+		Repo:               repo,
+		ProjectName:        app.Spec.GetProject(),
+		AppLabelKey:        r.appLabelKey(),
+		TrackingMethod:     r.opts.TrackingMethod,
+		KubeVersion:        capabilities.KubeVersion,
+		ApiVersions:        capabilities.APIVersions,
+	}
+	project, err := r.applicationProject(app)
+	if err != nil {
+		return nil, err
+	}
+	if project != nil {
+		request.ProjectSourceRepos = project.Spec.SourceRepos
+	}
+	if settings := r.opts.Settings; settings != nil {
+		kustomizeOptions, err := settings.kustomizeOptions(*source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get Kustomize options: %w", err)
+		}
+		request.KustomizeOptions = kustomizeOptions
+		request.HelmOptions = settings.HelmOptions
+		request.EnabledSourceTypes = settings.EnabledSourceTypes
+		request.InstallationID = settings.InstallationID
+	}
+	return request, nil
+}
+
+// liveSettings returns the settings the live state is compared with, tracking resources the same way
+// they are rendered
+func (r *Renderer) liveSettings() *ArgoCDSettings {
+	settings := ArgoCDSettings{}
+	if r.opts.Settings != nil {
+		settings = *r.opts.Settings
+	}
+	settings.TrackingMethod = r.opts.TrackingMethod
+	settings.AppInstanceLabelKey = r.opts.AppInstanceLabelKey
+	return &settings
+}
+
+// validateTrackingMethod returns an error if the tracking method is not supported by Argo CD
+func validateTrackingMethod(method string) error {
+	switch argoappv1.TrackingMethod(method) {
+	case "", argo.TrackingMethodAnnotation, argo.TrackingMethodLabel, argo.TrackingMethodAnnotationAndLabel:
+		return nil
+	default:
+		return fmt.Errorf("unknown tracking method '%s', expected one of: annotation, label, annotation+label", method)
+	}
+}
+
+// appLabelKey returns the app instance label key the repo service injects tracking metadata with,
+// or an empty string when no tracking metadata should be injected
+func (r *Renderer) appLabelKey() string {
+	if r.opts.TrackingMethod == "" {
+		return ""
+	}
+	return r.opts.AppInstanceLabelKey
+}
+
+// renderedSources holds the resources rendered for an Application, by source index
+type renderedSources [][]*unstructured.Unstructured
+
+// flatten returns the resources of all the sources, in source order
+func (s renderedSources) flatten() []*unstructured.Unstructured {
+	var resources []*unstructured.Unstructured
+	for _, sourceResources := range s {
+		resources = append(resources, sourceResources...)
+	}
+	return resources
+}
+
+// RenderApplication generates the Kubernetes resources of an Application.
+// A resource rendered more than once is only kept once, the last one, like Argo CD does.
+// If ctx is cancelled, the partially fetched repositories and charts are removed from the cache dir.
+func (r *Renderer) RenderApplication(
+	ctx context.Context,
+	app argoappv1.Application,
+) ([]*unstructured.Unstructured, error) {
+	sources, _, err := r.renderApplication(ctx, app)
+	if err != nil {
+		if ctx.Err() != nil {
+			r.removePartialWork()
+		}
+		return nil, err
+	}
+	return sources.flatten(), nil
+}
+
+// RenderApplications renders several Applications, up to Options.Parallelism at a time.
+// The result at index i holds the resources of apps[i].
+func (r *Renderer) RenderApplications(
+	ctx context.Context,
+	apps []argoappv1.Application,
+) ([][]*unstructured.Unstructured, error) {
+	results, _, err := r.RenderApplicationsWithDuplicates(ctx, apps)
+	return results, err
+}
+
+// RenderApplicationsWithDuplicates renders several Applications like RenderApplications does, also returning
+// the resources rendered more than once by an Application, of which only the last one is kept, and the
+// resources shared by several Applications
+func (r *Renderer) RenderApplicationsWithDuplicates(
+	ctx context.Context,
+	apps []argoappv1.Application,
+) ([][]*unstructured.Unstructured, []DuplicateResource, error) {
+	rendered, duplicates, err := r.renderApplicationSources(ctx, apps)
+	if err != nil {
+		return nil, nil, err
+	}
+	results := make([][]*unstructured.Unstructured, len(rendered))
+	for i, sources := range rendered {
+		results[i] = sources.flatten()
+	}
+	return results, duplicates, nil
+}
+
+// renderApplicationSources renders several Applications, up to Options.Parallelism at a time,
+// keeping the resources of each Application grouped by source, and returns the duplicate resources:
+// those repeated by each Application, followed by those shared by several Applications
+func (r *Renderer) renderApplicationSources(
+	ctx context.Context,
+	apps []argoappv1.Application,
+) ([]renderedSources, []DuplicateResource, error) {
+	results := make([]renderedSources, len(apps))
+	repeated := make([][]DuplicateResource, len(apps))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(r.opts.Parallelism)
+	for i := range apps {
+		g.Go(func() error {
+			resources, duplicates, err := r.renderApplication(gctx, apps[i])
+			if err != nil {
+				return err
+			}
+			results[i], repeated[i] = resources, duplicates
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		// The group context is cancelled by any failure, only the cancellation of the caller is an interruption
+		if ctx.Err() != nil {
+			r.removePartialWork()
+		}
+		return nil, nil, err
+	}
+	shared, err := checkSharedResources(apps, results)
+	if err != nil {
+		return nil, nil, err
+	}
+	var duplicates []DuplicateResource
+	for _, appDuplicates := range repeated {
+		duplicates = append(duplicates, appDuplicates...)
+	}
+	return results, append(duplicates, shared...), nil
+}
+
+// renderApplication renders an Application, applying the per-Application timeout, and returns the resources
+// it renders more than once
+func (r *Renderer) renderApplication(
+	ctx context.Context,
+	app argoappv1.Application,
+) (renderedSources, []DuplicateResource, error) {
+	if r.opts.AppTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.opts.AppTimeout)
+		defer cancel()
+	}
+
+	project, err := r.applicationProject(app)
+	if err != nil {
+		return nil, nil, err
+	}
+	if project != nil {
+		if err := validateApplicationProject(app, project); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	manifests, err := r.generateAppManifests(ctx, app)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) && r.opts.AppTimeout > 0 {
+			return nil, nil, fmt.Errorf(
+				"rendering application '%s' timed out after %s: %w", app.Name, r.opts.AppTimeout, err)
+		}
+		return nil, nil, err
+	}
+
+	sources := make(renderedSources, 0, len(manifests))
+	for _, sourceManifests := range manifests {
+		resources, err := parseManifests(sourceManifests)
+		if err != nil {
+			return nil, nil, err
+		}
+		sources = append(sources, r.dropExcludedResources(app, resources))
+	}
+	if r.opts.InjectNamespace {
+		injectDestinationNamespace(app, sources)
+	}
+	sources, repeated := dropRepeatedResources(app, sources)
+	if project != nil {
+		if err := validateProjectResources(app, project, sources.flatten()); err != nil {
+			return nil, nil, err
+		}
+	}
+	return sources, repeated, nil
+}
+
+// dropExcludedResources removes the resources that Argo CD ignores according to the resource exclusions
+// and inclusions of the settings, warning about them like Argo CD does with an ExcludedResourceWarning
+func (r *Renderer) dropExcludedResources(
+	app argoappv1.Application,
+	resources []*unstructured.Unstructured,
+) []*unstructured.Unstructured {
+	cluster := destinationCluster(app)
+	kept := resources[:0]
+	for _, resource := range resources {
+		if r.opts.Settings.isExcluded(resource, cluster) {
+			key := kube.GetResourceKey(resource)
+			log.Warnf("Application %s: resource %s is excluded in the settings", app.Name, key.String())
+			continue
+		}
+		kept = append(kept, resource)
+	}
+	return kept
+}
+
+// destinationCluster returns the destination cluster of an Application, by URL or else by name
+func destinationCluster(app argoappv1.Application) string {
+	if app.Spec.Destination.Server != "" {
+		return app.Spec.Destination.Server
+	}
+	return app.Spec.Destination.Name
+}
+
+// generateManifest calls the repo service, returning as soon as ctx is done since
+// the Git and Helm clients of the repo service do not honour cancellation themselves.
+// The call keeps running in the background, tracked until it returns.
+func (r *Renderer) generateManifest(
+	ctx context.Context,
+	request *repoapiclient.ManifestRequest,
+) (*repoapiclient.ManifestResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		response *repoapiclient.ManifestResponse
+		err      error
+	}
+	done := make(chan result, 1)
+	repos := requestRepos(request)
+	r.recordFetch(repos, false)
+	r.fetches.Add(1)
+	go func() {
+		defer r.fetches.Done()
+		response, err := r.generate(ctx, request)
+		r.recordFetch(repos, err == nil)
+		done <- result{response: response, err: err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-done:
+		return res.response, res.err
+	}
+}
+
+// listCacheDir returns the names of the entries in the cache dir.
+// The repo service keeps the cache dir write-only, so it is made readable for the duration of the call.
+func (r *Renderer) listCacheDir() (map[string]bool, error) {
+	if err := os.Chmod(r.opts.CacheDir, 0o700); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.Chmod(r.opts.CacheDir, 0o300); err != nil {
+			log.Warnf("Failed to restore cache directory permissions: %v", err)
+		}
+	}()
+
+	dirEntries, err := os.ReadDir(r.opts.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]bool, len(dirEntries))
+	for _, entry := range dirEntries {
+		entries[entry.Name()] = true
+	}
+	return entries, nil
+}
+
+// waitForFetches waits for the running repo service calls to return, returning false if they are still
+// running after the grace period
+func (r *Renderer) waitForFetches() bool {
+	done := make(chan struct{})
+	go func() {
+		r.fetches.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-time.After(r.fetchGracePeriod):
+		return false
+	}
+}
+
+// requestRepos returns the normalized URLs of the Git repositories a manifest request fetches
+func requestRepos(request *repoapiclient.ManifestRequest) []string {
+	var repos []string
+	if request.Repo != nil {
+		repos = append(repos, git.NormalizeGitURL(request.Repo.Repo))
+	}
+	for _, refSource := range request.RefSources {
+		repos = append(repos, git.NormalizeGitURL(refSource.Repo.Repo))
+	}
+	return repos
+}
+
+// recordFetch records that repositories are being fetched, or were fetched successfully
+func (r *Renderer) recordFetch(repos []string, succeeded bool) {
+	r.fetchedReposLock.Lock()
+	defer r.fetchedReposLock.Unlock()
+	for _, repo := range repos {
+		r.fetchedRepos[repo] = r.fetchedRepos[repo] || succeeded
+	}
+}
+
+// isPartialWork returns true if a cache dir entry was created by this Renderer for a repository that none of
+// its repo service calls managed to fetch. The repo service clones each repository into a directory of its own,
+// whose origin remote tells the repository apart.
+func (r *Renderer) isPartialWork(name string) bool {
+	if r.cachedEntries[name] {
+		return false
+	}
+	path := filepath.Join(r.opts.CacheDir, name)
+	info, err := os.Stat(path)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+	// The repo service removes all permissions from the checkouts it does not use
+	if err := os.Chmod(path, 0o700); err != nil {
+		return false
+	}
+	output, err := exec.Command("git", "--git-dir", filepath.Join(path, ".git"),
+		"config", "--get", "remote.origin.url").Output()
+	partial := false
+	if err == nil {
+		r.fetchedReposLock.Lock()
+		succeeded, fetched := r.fetchedRepos[git.NormalizeGitURL(strings.TrimSpace(string(output)))]
+		r.fetchedReposLock.Unlock()
+		partial = fetched && !succeeded
+	}
+	if !partial {
+		if err := os.Chmod(path, info.Mode().Perm()); err != nil {
+			log.Warnf("Failed to restore permissions of %s: %v", path, err)
+		}
+	}
+	return partial
+}
+
+// removePartialWork deletes the repositories this Renderer was still fetching when it was interrupted, so that
+// an interrupted fetch does not leave a broken checkout behind. The entries of the cache dir that existed
+// before, that were fetched successfully or that belong to other processes are kept. The fetches still
+// running are waited for first, so that they do not write to the removed entries.
+func (r *Renderer) removePartialWork() {
+	if !r.waitForFetches() {
+		log.Warnf("Repositories and charts are still being fetched after %s, not removing them from %s",
+			r.fetchGracePeriod, r.opts.CacheDir)
+		return
+	}
+	entries, err := r.listCacheDir()
+	if err != nil {
+		log.Warnf("Failed to read cache directory %s: %v", r.opts.CacheDir, err)
+		return
+	}
+	for name := range entries {
+		if !r.isPartialWork(name) {
+			continue
+		}
+		path := filepath.Join(r.opts.CacheDir, name)
+		log.Debugf("Removing partially fetched %s", path)
+		if err := os.RemoveAll(path); err != nil {
+			log.Warnf("Failed to remove %s: %v", path, err)
+		}
+	}
+}
+
+// parseManifests decodes the JSON manifests returned by the repo server
+func parseManifests(manifests []string) ([]*unstructured.Unstructured, error) {
+	resources := make([]*unstructured.Unstructured, 0, len(manifests))
+	for _, manifest := range manifests {
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal([]byte(manifest), obj); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+		resources = append(resources, obj)
+	}
+	return resources, nil
+}
@@ -0,0 +1,283 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	repoapiclient "github.com/argoproj/argo-cd/v3/reposerver/apiclient"
+	"github.com/argoproj/argo-cd/v3/util/git"
+	"github.com/stretchr/testify/require"
+)
+
+// TestNewRendererDefaults verifies that unset options fall back to their defaults
+func TestNewRendererDefaults(t *testing.T) {
+	renderer, err := NewRenderer(Options{})
+	require.NoError(t, err)
+
+	require.Equal(t, getCacheDir(), renderer.opts.CacheDir)
+	require.NotNil(t, renderer.opts.Credentials)
+	require.Equal(t, 1, renderer.opts.Parallelism)
+}
+
+// TestRendererTracking verifies that tracking metadata is only injected when a tracking method is set,
+// by passing the tracking method and label key with the manifest requests
+func TestRendererTracking(t *testing.T) {
+	app := argoappv1.Application{}
+	app.Name = "web"
+	source := &argoappv1.ApplicationSource{RepoURL: "https://example.com/repo.git", Path: "web"}
+	repo := &argoappv1.Repository{Repo: source.RepoURL}
+
+	renderer, err := NewRenderer(Options{})
+	require.NoError(t, err)
+	require.Empty(t, renderer.appLabelKey())
+	request, err := renderer.manifestRequest(app, source, repo)
+	require.NoError(t, err)
+	require.Empty(t, request.TrackingMethod)
+	require.Empty(t, request.AppLabelKey)
+
+	renderer, err = NewRenderer(Options{TrackingMethod: "annotation+label"})
+	require.NoError(t, err)
+	require.Equal(t, "app.kubernetes.io/instance", renderer.appLabelKey())
+	request, err = renderer.manifestRequest(app, source, repo)
+	require.NoError(t, err)
+	require.Equal(t, "annotation+label", request.TrackingMethod)
+	require.Equal(t, "app.kubernetes.io/instance", request.AppLabelKey)
+
+	renderer, err = NewRenderer(Options{TrackingMethod: "annotation", AppInstanceLabelKey: "example.com/app"})
+	require.NoError(t, err)
+	request, err = renderer.manifestRequest(app, source, repo)
+	require.NoError(t, err)
+	require.Equal(t, "annotation", request.TrackingMethod)
+	require.Equal(t, "example.com/app", request.AppLabelKey)
+
+	renderer, err = NewRenderer(Options{TrackingMethod: "label", AppInstanceLabelKey: "example.com/app"})
+	require.NoError(t, err)
+	require.Equal(t, "example.com/app", renderer.appLabelKey())
+	request, err = renderer.manifestRequest(app, source, repo)
+	require.NoError(t, err)
+	require.Equal(t, "label", request.TrackingMethod)
+	require.Equal(t, "example.com/app", request.AppLabelKey)
+
+	_, err = NewRenderer(Options{TrackingMethod: "labels"})
+	require.ErrorContains(t, err, "unknown tracking method 'labels'")
+}
+
+// TestRendererCredentials verifies that a custom CredentialsFunc is used for remote sources
+func TestRendererCredentials(t *testing.T) {
+	renderer, err := NewRenderer(Options{
+		Credentials: func(repoURL string) (string, string) {
+			return "user-" + repoURL, "secret"
+		},
+	})
+	require.NoError(t, err)
+
+	apps := loadApplications("../testdata/test-app-all-helm.yaml")
+	sources := apps[0].Spec.GetSources()
+	repo := renderer.createRepoOverride(sources[0], "", 0, apps[0].Name)
+
+	require.Equal(t, sources[0].RepoURL, repo.Repo)
+	require.Equal(t, "user-"+sources[0].RepoURL, repo.Username)
+	require.Equal(t, "secret", repo.Password)
+}
+
+// TestExpandApplicationSet verifies that the list generator produces one Application per element
+func TestExpandApplicationSet(t *testing.T) {
+	appSets, err := LoadApplicationSets("../testdata/test-appset.yaml")
+	require.NoError(t, err)
+	require.Len(t, appSets, 1)
+
+	renderer, err := NewRenderer(Options{})
+	require.NoError(t, err)
+
+	apps, err := renderer.ExpandApplicationSet(context.Background(), appSets[0])
+	require.NoError(t, err)
+	require.Len(t, apps, 2)
+	require.Equal(t, "guestbook-staging", apps[0].Name)
+	require.Equal(t, "guestbook-staging", apps[0].Spec.Destination.Namespace)
+	require.Equal(t, "guestbook-production", apps[1].Name)
+
+	// Expanding an ApplicationSet needs no Renderer
+	standalone, err := ExpandApplicationSet(context.Background(), appSets[0])
+	require.NoError(t, err)
+	require.Equal(t, apps, standalone)
+}
+
+// TestParseManifests verifies that repo server manifests are decoded into unstructured objects
+func TestParseManifests(t *testing.T) {
+	resources, err := parseManifests([]string{
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"first"}}`,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"second"}}`,
+	})
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+	require.Equal(t, "ConfigMap", resources[0].GetKind())
+	require.Equal(t, "second", resources[1].GetName())
+
+	_, err = parseManifests([]string{"not json"})
+	require.Error(t, err)
+}
+
+// newTestRenderer creates a Renderer using a temporary cache dir
+func newTestRenderer(t *testing.T, opts Options) *Renderer {
+	t.Helper()
+	opts.CacheDir = filepath.Join(t.TempDir(), "cache")
+	renderer, err := NewRenderer(opts)
+	require.NoError(t, err)
+	// The repo service makes the cache dir write-only, restore access so it can be removed
+	t.Cleanup(func() { _ = os.Chmod(opts.CacheDir, 0o700) })
+	return renderer
+}
+
+// TestRenderApplicationsCancelled verifies that a cancelled context stops rendering, keeping the cache entries
+// this Renderer did not fetch
+func TestRenderApplicationsCancelled(t *testing.T) {
+	renderer := newTestRenderer(t, Options{})
+	existing := filepath.Join(renderer.opts.CacheDir, "existing")
+	require.NoError(t, os.Mkdir(existing, 0o700))
+	renderer.cachedEntries["existing"] = true
+	foreign := filepath.Join(renderer.opts.CacheDir, "foreign")
+	initCacheRepo(t, foreign, "https://github.com/argoproj/argocd-example-apps")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	apps := loadApplications("../testdata/test-app.yaml")
+	resources, err := renderer.RenderApplications(ctx, apps)
+	require.ErrorIs(t, err, context.Canceled)
+	require.Nil(t, resources)
+
+	require.DirExists(t, existing)
+	require.DirExists(t, foreign, "the repositories fetched by other processes are kept")
+}
+
+// initCacheRepo creates a Git repository cloned from url, as the repo service does in the cache dir
+func initCacheRepo(t *testing.T, path string, url string) {
+	t.Helper()
+	for _, args := range [][]string{{"init", "-q", path}, {"-C", path, "remote", "add", "origin", url}} {
+		output, err := exec.Command("git", args...).CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+}
+
+// slowFetch replaces the repo service of a Renderer with one creating a partial clone in the cache dir, then
+// blocking until ctx is done and release is closed, then writing to the clone again like an interrupted clone
+// would
+func slowFetch(t *testing.T, renderer *Renderer, started chan<- struct{}, release <-chan struct{}) string {
+	partial := filepath.Join(renderer.opts.CacheDir, "partial")
+	renderer.generate = func(
+		ctx context.Context,
+		request *repoapiclient.ManifestRequest,
+	) (*repoapiclient.ManifestResponse, error) {
+		initCacheRepo(t, partial, request.Repo.Repo)
+		close(started)
+		<-ctx.Done()
+		<-release
+		if err := os.WriteFile(filepath.Join(partial, "HEAD"), nil, 0o600); err != nil {
+			return nil, err
+		}
+		return nil, ctx.Err()
+	}
+	return partial
+}
+
+// TestRenderApplicationsCancelledDuringFetch verifies that the partial work is only removed once the fetch
+// being cancelled has returned
+func TestRenderApplicationsCancelledDuringFetch(t *testing.T) {
+	renderer := newTestRenderer(t, Options{})
+	started, release := make(chan struct{}), make(chan struct{})
+	partial := slowFetch(t, renderer, started, release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+	}()
+
+	_, err := renderer.RenderApplications(ctx, loadApplications("../testdata/test-app.yaml"))
+	require.ErrorIs(t, err, context.Canceled)
+	require.NoDirExists(t, partial)
+}
+
+// TestRenderApplicationsCancelledFetchGracePeriod verifies that the partial work is left alone when the fetch
+// being cancelled does not return within the grace period
+func TestRenderApplicationsCancelledFetchGracePeriod(t *testing.T) {
+	renderer := newTestRenderer(t, Options{})
+	renderer.fetchGracePeriod = 10 * time.Millisecond
+	started, release := make(chan struct{}), make(chan struct{})
+	partial := slowFetch(t, renderer, started, release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, err := renderer.RenderApplications(ctx, loadApplications("../testdata/test-app.yaml"))
+	require.ErrorIs(t, err, context.Canceled)
+	require.DirExists(t, partial)
+	close(release)
+	renderer.fetches.Wait()
+}
+
+// TestRemovePartialWork verifies that only the repositories this Renderer failed to fetch are removed
+func TestRemovePartialWork(t *testing.T) {
+	renderer := newTestRenderer(t, Options{})
+	entry := func(name string) string { return filepath.Join(renderer.opts.CacheDir, name) }
+	initCacheRepo(t, entry("existing"), "https://example.com/partial.git")
+	renderer.cachedEntries["existing"] = true
+	initCacheRepo(t, entry("fetched"), "https://example.com/fetched.git")
+	initCacheRepo(t, entry("partial"), "https://example.com/partial.git")
+	initCacheRepo(t, entry("foreign"), "https://example.com/foreign.git")
+	require.NoError(t, os.Mkdir(entry("other"), 0o700))
+	require.NoError(t, os.Chmod(entry("fetched"), 0o000))
+	fetched := git.NormalizeGitURL("https://example.com/fetched.git")
+	renderer.recordFetch([]string{fetched, git.NormalizeGitURL("https://example.com/partial.git")}, false)
+	renderer.recordFetch([]string{fetched}, true)
+
+	renderer.removePartialWork()
+	require.NoDirExists(t, entry("partial"))
+	for _, name := range []string{"existing", "fetched", "foreign", "other"} {
+		require.DirExists(t, entry(name))
+	}
+	info, err := os.Stat(entry("fetched"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0), info.Mode().Perm(), "the permissions of the kept entries are restored")
+}
+
+// TestRenderApplicationsFailureKeepsCache verifies that a render failure that is not a cancellation keeps
+// what was fetched in the cache dir
+func TestRenderApplicationsFailureKeepsCache(t *testing.T) {
+	renderer := newTestRenderer(t, Options{})
+	fetched := filepath.Join(renderer.opts.CacheDir, "fetched")
+	renderer.generate = func(
+		_ context.Context,
+		_ *repoapiclient.ManifestRequest,
+	) (*repoapiclient.ManifestResponse, error) {
+		if err := os.Mkdir(fetched, 0o700); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("path guestbook does not exist")
+	}
+
+	_, err := renderer.RenderApplications(context.Background(), loadApplications("../testdata/test-app.yaml"))
+	require.ErrorContains(t, err, "path guestbook does not exist")
+	require.DirExists(t, fetched)
+}
+
+// TestRenderApplicationTimeout verifies that the per-Application timeout is reported with the app name
+func TestRenderApplicationTimeout(t *testing.T) {
+	renderer := newTestRenderer(t, Options{AppTimeout: time.Nanosecond})
+
+	apps := loadApplications("../testdata/test-app.yaml")
+	_, err := renderer.RenderApplication(context.Background(), apps[0])
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Contains(t, err.Error(), "rendering application 'test-app' timed out")
+}
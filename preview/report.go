@@ -0,0 +1,314 @@
+package preview
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Diff output format constants
+const (
+	diffFormatText     = "text"
+	diffFormatMarkdown = "markdown"
+	diffFormatHTML     = "html"
+)
+
+// ReportOptions configures the Markdown and HTML diff reports
+type ReportOptions struct {
+	// Title is the heading of the report
+	Title string
+	// MaxDiffLines truncates the diff of each resource to this number of lines. Zero means no truncation.
+	MaxDiffLines int
+	// Duplicates lists the resources rendered more than once, reported after the diffs
+	Duplicates []DuplicateResource
+}
+
+// reportKind groups the resource diffs of an Application sharing the same kind
+type reportKind struct {
+	Kind      string
+	Resources []reportResource
+}
+
+// reportResource is a resource diff prepared for a report
+type reportResource struct {
+	Key    string
+	Change ChangeType
+	Diff   string
+}
+
+// reportApplication is an Application diff prepared for a report
+type reportApplication struct {
+	Name    string
+	Change  ChangeType
+	Counts  changeCounts
+	Kinds   []reportKind
+	Summary string
+}
+
+// changeCounts counts the added, changed and removed resources
+type changeCounts struct {
+	Added   int
+	Changed int
+	Removed int
+}
+
+func (c *changeCounts) add(change ChangeType) {
+	switch change {
+	case ChangeAdded:
+		c.Added++
+	case ChangeRemoved:
+		c.Removed++
+	default:
+		c.Changed++
+	}
+}
+
+func (c changeCounts) String() string {
+	return fmt.Sprintf("%d added, %d changed, %d removed", c.Added, c.Changed, c.Removed)
+}
+
+// buildReport groups the resource diffs of each Application by kind and counts the changes
+func buildReport(diffs []ApplicationDiff, opts ReportOptions) ([]reportApplication, changeCounts) {
+	var total changeCounts
+	apps := make([]reportApplication, 0, len(diffs))
+	for _, appDiff := range diffs {
+		// Applications in sync with the live state carry no change
+		if appDiff.Change == "" {
+			continue
+		}
+		app := reportApplication{Name: appDiff.Name, Change: appDiff.Change}
+		byKind := map[string][]reportResource{}
+		for _, resourceDiff := range appDiff.Resources {
+			app.Counts.add(resourceDiff.Change)
+			total.add(resourceDiff.Change)
+			kind := resourceDiff.Key.Kind
+			byKind[kind] = append(byKind[kind], reportResource{
+				Key:    resourceDiff.Key.String(),
+				Change: resourceDiff.Change,
+				Diff:   truncateDiff(resourceDiff.Diff, opts.MaxDiffLines),
+			})
+		}
+
+		kinds := make([]string, 0, len(byKind))
+		for kind := range byKind {
+			kinds = append(kinds, kind)
+		}
+		sort.Strings(kinds)
+		for _, kind := range kinds {
+			app.Kinds = append(app.Kinds, reportKind{Kind: kind, Resources: byKind[kind]})
+		}
+		app.Summary = app.Counts.String()
+		apps = append(apps, app)
+	}
+	return apps, total
+}
+
+// truncateDiff keeps the first maxLines lines of a diff, noting how many lines were dropped
+func truncateDiff(diff string, maxLines int) string {
+	lines := strings.SplitAfter(strings.TrimSuffix(diff, "\n"), "\n")
+	if maxLines <= 0 || len(lines) <= maxLines {
+		return strings.TrimSuffix(diff, "\n")
+	}
+	return strings.Join(lines[:maxLines], "") + fmt.Sprintf("... (%d more lines)", len(lines)-maxLines)
+}
+
+// WriteMarkdownReport writes the diffs as a Markdown summary, with a collapsible section per Application,
+// suitable for a pull request comment
+func WriteMarkdownReport(w io.Writer, diffs []ApplicationDiff, opts ReportOptions) error {
+	apps, total := buildReport(diffs, opts)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "## %s\n\n", opts.Title)
+	if len(apps) == 0 {
+		b.WriteString("No differences found\n")
+	} else {
+		writeMarkdownApplications(&b, apps, total)
+	}
+
+	if len(opts.Duplicates) > 0 {
+		b.WriteString("\n### Duplicate resources\n\n")
+		for _, duplicate := range opts.Duplicates {
+			fmt.Fprintf(&b, "- %s\n", markdownCodeSpan(duplicate.String()))
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMarkdownApplications writes the summary table and the collapsible diffs of the Applications
+func writeMarkdownApplications(b *strings.Builder, apps []reportApplication, total changeCounts) {
+	fmt.Fprintf(b, "%d application(s) with differences: %s\n\n", len(apps), total)
+	b.WriteString("| Application | Status | Added | Changed | Removed |\n")
+	b.WriteString("|---|---|---:|---:|---:|\n")
+	for _, app := range apps {
+		fmt.Fprintf(b, "| %s | %s | %d | %d | %d |\n", markdownCodeSpan(app.Name), markdownCodeSpan(string(app.Change)),
+			app.Counts.Added, app.Counts.Changed, app.Counts.Removed)
+	}
+
+	for _, app := range apps {
+		fmt.Fprintf(b, "\n<details>\n<summary><b>%s</b> (%s): %s</summary>\n",
+			template.HTMLEscapeString(app.Name), app.Change, app.Summary)
+		for _, kind := range app.Kinds {
+			fmt.Fprintf(b, "\n#### %s\n", kind.Kind)
+			for _, resource := range kind.Resources {
+				fmt.Fprintf(b, "\n<details>\n<summary>%s (%s)</summary>\n\n",
+					template.HTMLEscapeString(resource.Key), resource.Change)
+				fence := markdownFence(resource.Diff)
+				fmt.Fprintf(b, "%sdiff\n%s\n%s\n\n</details>\n", fence, resource.Diff, fence)
+			}
+		}
+		b.WriteString("\n</details>\n")
+	}
+}
+
+// markdownFence returns a code fence longer than any backtick sequence found in the text
+func markdownFence(text string) string {
+	fence := "```"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	return fence
+}
+
+// markdownCodeSpan returns the text as a code span that can be put in a Markdown table cell: delimited by more
+// backticks than any sequence found in the text, like markdownFence does, and with its pipes escaped
+func markdownCodeSpan(text string) string {
+	fence := "`"
+	for strings.Contains(text, fence) {
+		fence += "`"
+	}
+	text = strings.ReplaceAll(text, "|", `\|`)
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return fence + text + fence
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+td.count { text-align: right; }
+summary { cursor: pointer; margin: 4px 0; }
+details details { margin-left: 1.5em; }
+pre { background: #f6f8fa; padding: 8px; overflow-x: auto; }
+.added { color: #22863a; }
+.removed { color: #b31d28; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{- if not .Applications}}
+<p>No differences found</p>
+{{- else}}
+<p>{{len .Applications}} application(s) with differences: {{.Total}}</p>
+<table>
+<tr><th>Application</th><th>Status</th><th>Added</th><th>Changed</th><th>Removed</th></tr>
+{{- range .Applications}}
+<tr><td>{{.Name}}</td><td>{{.Change}}</td><td class="count">{{.Counts.Added}}</td>` +
+	`<td class="count">{{.Counts.Changed}}</td><td class="count">{{.Counts.Removed}}</td></tr>
+{{- end}}
+</table>
+{{- range .Applications}}
+<details>
+<summary><b>{{.Name}}</b> ({{.Change}}): {{.Summary}}</summary>
+{{- range .Kinds}}
+<h3>{{.Kind}}</h3>
+{{- range .Resources}}
+<details>
+<summary>{{.Key}} ({{.Change}})</summary>
+<pre>{{range .Lines}}<span class="{{.Class}}">{{.Text}}</span>
+{{end}}</pre>
+</details>
+{{- end}}
+{{- end}}
+</details>
+{{- end}}
+{{- end}}
+{{- if .Duplicates}}
+<h2>Duplicate resources</h2>
+<ul>
+{{- range .Duplicates}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+</body>
+</html>
+`))
+
+// htmlDiffLine is a line of a diff, styled according to whether it was added or removed
+type htmlDiffLine struct {
+	Class string
+	Text  string
+}
+
+// Lines splits the diff of a resource into styled lines for the HTML report
+func (r reportResource) Lines() []htmlDiffLine {
+	var lines []htmlDiffLine
+	for _, line := range strings.Split(r.Diff, "\n") {
+		class := ""
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		case strings.HasPrefix(line, "+"):
+			class = "added"
+		case strings.HasPrefix(line, "-"):
+			class = "removed"
+		}
+		lines = append(lines, htmlDiffLine{Class: class, Text: line})
+	}
+	return lines
+}
+
+// WriteHTMLReport writes the diffs as a standalone HTML page, with a collapsible section per Application
+func WriteHTMLReport(w io.Writer, diffs []ApplicationDiff, opts ReportOptions) error {
+	apps, total := buildReport(diffs, opts)
+	return htmlReportTemplate.Execute(w, struct {
+		Title        string
+		Applications []reportApplication
+		Total        changeCounts
+		Duplicates   []DuplicateResource
+	}{Title: opts.Title, Applications: apps, Total: total, Duplicates: opts.Duplicates})
+}
+
+// writeDiffReport writes the diffs in the given format, using writeText for the text format,
+// followed by the duplicate resources
+func writeDiffReport(
+	w io.Writer,
+	diffs []ApplicationDiff,
+	format string,
+	opts ReportOptions,
+	writeText func(io.Writer, []ApplicationDiff) error,
+) error {
+	switch format {
+	case diffFormatText:
+		if err := writeText(w, diffs); err != nil {
+			return err
+		}
+		return printDuplicates(w, opts.Duplicates, format)
+	case diffFormatMarkdown:
+		return WriteMarkdownReport(w, diffs, opts)
+	case diffFormatHTML:
+		return WriteHTMLReport(w, diffs, opts)
+	default:
+		return checkDiffFormat(format)
+	}
+}
+
+// checkDiffFormat returns an error if the diff output format is not supported
+func checkDiffFormat(format string) error {
+	switch format {
+	case diffFormatText, diffFormatMarkdown, diffFormatHTML:
+		return nil
+	default:
+		return fmt.Errorf("unknown diff output format '%s', expected one of: text, markdown, html", format)
+	}
+}
@@ -0,0 +1,137 @@
+package preview
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	"github.com/stretchr/testify/require"
+)
+
+// testReportDiffs returns Application diffs covering every kind of change
+func testReportDiffs() []ApplicationDiff {
+	return []ApplicationDiff{
+		{Name: "synced"},
+		{
+			Name:   "web",
+			Change: ChangeModified,
+			Resources: []ResourceDiff{
+				{
+					Key:    kube.NewResourceKey("apps", "Deployment", "prod", "web"),
+					Change: ChangeModified,
+					Diff:   "--- base/apps/Deployment/prod/web\n+++ head/apps/Deployment/prod/web\n-  replicas: 1\n+  replicas: 2\n",
+				},
+				{
+					Key:    kube.NewResourceKey("", "ConfigMap", "prod", "settings"),
+					Change: ChangeAdded,
+					Diff:   "+kind: ConfigMap\n",
+				},
+				{
+					Key:    kube.NewResourceKey("", "ConfigMap", "prod", "legacy"),
+					Change: ChangeRemoved,
+					Diff:   "-kind: ConfigMap\n",
+				},
+			},
+		},
+	}
+}
+
+// TestBuildReport verifies that resource diffs are counted and grouped by kind
+func TestBuildReport(t *testing.T) {
+	apps, total := buildReport(testReportDiffs(), ReportOptions{})
+
+	require.Len(t, apps, 1, "Applications without change are left out")
+	require.Equal(t, changeCounts{Added: 1, Changed: 1, Removed: 1}, total)
+	require.Equal(t, "1 added, 1 changed, 1 removed", apps[0].Summary)
+	require.Len(t, apps[0].Kinds, 2)
+	require.Equal(t, "ConfigMap", apps[0].Kinds[0].Kind)
+	require.Len(t, apps[0].Kinds[0].Resources, 2)
+	require.Equal(t, "Deployment", apps[0].Kinds[1].Kind)
+}
+
+// TestTruncateDiff verifies that long diffs are cut with a note of the dropped lines
+func TestTruncateDiff(t *testing.T) {
+	require.Equal(t, "a\nb", truncateDiff("a\nb\n", 2))
+	require.Equal(t, "a\nb", truncateDiff("a\nb\n", 0))
+	require.Equal(t, "a\n... (2 more lines)", truncateDiff("a\nb\nc\n", 1))
+}
+
+// TestWriteMarkdownReport verifies the collapsible Markdown summary
+func TestWriteMarkdownReport(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteMarkdownReport(&buf, testReportDiffs(), ReportOptions{Title: "Manifest diff", MaxDiffLines: 3})
+	require.NoError(t, err)
+
+	out := buf.String()
+	require.True(t, strings.HasPrefix(out, "## Manifest diff\n"))
+	require.Contains(t, out, "| `web` | `modified` | 1 | 1 | 1 |\n")
+	require.NotContains(t, out, "synced`")
+	require.Contains(t, out, "<summary><b>web</b> (modified): 1 added, 1 changed, 1 removed</summary>")
+	require.Contains(t, out, "#### ConfigMap\n")
+	require.Contains(t, out, "<summary>apps/Deployment/prod/web (modified)</summary>")
+	require.Contains(t, out, "```diff\n")
+	require.Contains(t, out, "-  replicas: 1\n... (1 more lines)\n```")
+	require.Equal(t, strings.Count(out, "<details>"), strings.Count(out, "</details>"))
+}
+
+// TestMarkdownCodeSpan verifies that the table cells keep pipes and backticks from breaking the table
+func TestMarkdownCodeSpan(t *testing.T) {
+	require.Equal(t, "`web`", markdownCodeSpan("web"))
+	require.Equal(t, "`a\\|b`", markdownCodeSpan("a|b"))
+	require.Equal(t, "``a`b``", markdownCodeSpan("a`b"))
+	require.Equal(t, "`` `a ``", markdownCodeSpan("`a"))
+}
+
+// TestWriteMarkdownReportNoDifferences verifies the report when nothing changed
+func TestWriteMarkdownReportNoDifferences(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteMarkdownReport(&buf, nil, ReportOptions{Title: "Manifest diff"}))
+	require.Equal(t, "## Manifest diff\n\nNo differences found\n", buf.String())
+}
+
+// TestWriteHTMLReport verifies the standalone HTML page and the escaping of the diffs
+func TestWriteHTMLReport(t *testing.T) {
+	diffs := testReportDiffs()
+	diffs[1].Resources[1].Diff = "+  script: <b>x</b>\n"
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteHTMLReport(&buf, diffs, ReportOptions{Title: "Manifest diff"}))
+
+	out := buf.String()
+	require.Contains(t, out, "<title>Manifest diff</title>")
+	require.Contains(t, out, "<td>web</td><td>modified</td>")
+	require.Contains(t, out, `<span class="added">&#43;  script: &lt;b&gt;x&lt;/b&gt;</span>`)
+	require.Contains(t, out, `<span class="removed">-  replicas: 1</span>`)
+	require.Contains(t, out, `<span class="">--- base/apps/Deployment/prod/web</span>`)
+	require.NotContains(t, out, "synced")
+}
+
+// TestDiffReportDuplicates verifies that the duplicate resources are listed after the diffs in every format
+func TestDiffReportDuplicates(t *testing.T) {
+	opts := ReportOptions{Title: "Manifest diff", Duplicates: []DuplicateResource{{
+		Key:          kube.NewResourceKey("", "ConfigMap", "prod", "shared"),
+		Applications: []string{"web", "api"},
+	}}}
+
+	var buf bytes.Buffer
+	require.NoError(t, writeDiffReport(&buf, nil, diffFormatText, opts, writeDiff))
+	require.Equal(t, "No differences found\n\nDuplicate resources:\n"+
+		"- /ConfigMap/prod/shared is part of applications web, api\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeDiffReport(&buf, nil, diffFormatMarkdown, opts, writeDiff))
+	require.Equal(t, "## Manifest diff\n\nNo differences found\n\n### Duplicate resources\n\n"+
+		"- `/ConfigMap/prod/shared is part of applications web, api`\n", buf.String())
+
+	buf.Reset()
+	require.NoError(t, writeDiffReport(&buf, testReportDiffs(), diffFormatHTML, opts, writeDiff))
+	require.Contains(t, buf.String(), "<h2>Duplicate resources</h2>\n<ul>\n"+
+		"<li>/ConfigMap/prod/shared is part of applications web, api</li>\n</ul>\n</body>")
+}
+
+// TestWriteDiffReportUnknownFormat verifies that unsupported formats are rejected
+func TestWriteDiffReportUnknownFormat(t *testing.T) {
+	err := writeDiffReport(&bytes.Buffer{}, nil, "pdf", ReportOptions{}, writeDiff)
+	require.ErrorContains(t, err, "unknown diff output format 'pdf'")
+}
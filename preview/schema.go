@@ -0,0 +1,354 @@
+package preview
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	apiregistrationv1 "k8s.io/kube-aggregator/pkg/apis/apiregistration/v1"
+	openapierrors "k8s.io/kube-openapi/pkg/validation/errors"
+	"k8s.io/kube-openapi/pkg/validation/spec"
+	"k8s.io/kube-openapi/pkg/validation/strfmt"
+	"k8s.io/kube-openapi/pkg/validation/validate"
+	"k8s.io/kubernetes/pkg/generated/openapi"
+)
+
+// bundledKubeVersion is the Kubernetes version of the bundled OpenAPI schemas
+const bundledKubeVersion = "1.32"
+
+// Prefixes of the references to schema definitions, in OpenAPI v2 and v3 documents
+var definitionRefPrefixes = []string{"#/definitions/", "#/components/schemas/"}
+
+// Extensions of the Kubernetes OpenAPI schemas
+const (
+	extensionGroupVersionKind     = "x-kubernetes-group-version-kind"
+	extensionPreserveUnknownField = "x-kubernetes-preserve-unknown-fields"
+)
+
+// errSchemaNotFound is returned when validating a resource of a kind without a schema
+var errSchemaNotFound = errors.New("no schema found")
+
+// schemaRegistry holds the OpenAPI schemas resources are validated against, by kind
+type schemaRegistry struct {
+	definitions map[string]*spec.Schema
+	kinds       map[schema.GroupVersionKind]string
+	// groups are the API groups with schemas, whose kinds are all known
+	groups map[string]bool
+	// validators are the validators of the kinds already validated
+	validators map[schema.GroupVersionKind]*validate.SchemaValidator
+}
+
+// newSchemaRegistry returns a registry holding the schemas of a directory of OpenAPI documents,
+// or the bundled schemas of Kubernetes when no directory is given
+func newSchemaRegistry(schemaDir string) (*schemaRegistry, error) {
+	r := &schemaRegistry{
+		definitions: map[string]*spec.Schema{},
+		kinds:       map[schema.GroupVersionKind]string{},
+		groups:      map[string]bool{},
+		validators:  map[schema.GroupVersionKind]*validate.SchemaValidator{},
+	}
+	if schemaDir == "" {
+		return r, r.addBundledSchemas()
+	}
+	return r, r.addSchemaDir(schemaDir)
+}
+
+// addBundledSchemas adds the schemas of the Kubernetes version the binary is built with,
+// mapping them to kinds through the types registered in the client-go scheme
+func (r *schemaRegistry) addBundledSchemas() error {
+	refCallback := func(path string) spec.Ref {
+		return spec.MustCreateRef(definitionRefPrefixes[0] + path)
+	}
+	for name, definition := range openapi.GetOpenAPIDefinitions(refCallback) {
+		r.definitions[name] = &definition.Schema
+	}
+
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{
+		clientgoscheme.AddToScheme, apiextensionsv1.AddToScheme, apiregistrationv1.AddToScheme,
+	} {
+		if err := addToScheme(scheme); err != nil {
+			return err
+		}
+	}
+	for gvk, t := range scheme.AllKnownTypes() {
+		if gvk.Version == runtime.APIVersionInternal {
+			continue
+		}
+		if name := definitionName(t); r.definitions[name] != nil {
+			r.addKind(gvk, name)
+		}
+	}
+	return nil
+}
+
+// definitionName returns the name of the OpenAPI definition generated for a Go type
+func definitionName(t reflect.Type) string {
+	return t.PkgPath() + "." + t.Name()
+}
+
+// openAPIDocument holds the schemas of an OpenAPI v2 or v3 document
+type openAPIDocument struct {
+	Definitions map[string]*spec.Schema `json:"definitions"`
+	Components  struct {
+		Schemas map[string]*spec.Schema `json:"schemas"`
+	} `json:"components"`
+}
+
+// addSchemaDir adds the schemas of the OpenAPI documents (*.json) of a directory: the v2 swagger.json or the
+// v3 documents of each group version, as served by a cluster under /openapi or found under api/openapi-spec
+// in the Kubernetes repository
+func (r *schemaRegistry) addSchemaDir(dir string) error {
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	if len(filenames) == 0 {
+		return fmt.Errorf("no OpenAPI document (*.json) found in %s", dir)
+	}
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filepath.Clean(filename))
+		if err != nil {
+			return fmt.Errorf("failed to read OpenAPI document %s: %w", filename, err)
+		}
+		var document openAPIDocument
+		if err := json.Unmarshal(data, &document); err != nil {
+			return fmt.Errorf("failed to parse OpenAPI document %s: %w", filename, err)
+		}
+		for _, definitions := range []map[string]*spec.Schema{document.Definitions, document.Components.Schemas} {
+			for name, definition := range definitions {
+				r.definitions[name] = definition
+				for _, gvk := range schemaGroupVersionKinds(definition) {
+					r.addKind(gvk, name)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// schemaGroupVersionKinds returns the kinds a schema is declared for with the x-kubernetes-group-version-kind
+// extension
+func schemaGroupVersionKinds(s *spec.Schema) []schema.GroupVersionKind {
+	var gvks []schema.GroupVersionKind
+	for key, value := range s.Extensions {
+		if !strings.EqualFold(key, extensionGroupVersionKind) {
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &gvks); err != nil {
+			return nil
+		}
+	}
+	return gvks
+}
+
+// addKind registers the schema definition of a kind
+func (r *schemaRegistry) addKind(gvk schema.GroupVersionKind, name string) {
+	r.kinds[gvk] = name
+	r.groups[gvk.Group] = true
+	delete(r.validators, gvk)
+}
+
+// addCRD adds the schemas of the versions of a CustomResourceDefinition
+func (r *schemaRegistry) addCRD(resource *unstructured.Unstructured) error {
+	var crd apiextensionsv1.CustomResourceDefinition
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(resource.Object, &crd); err != nil {
+		return fmt.Errorf("failed to parse CRD %s: %w", resource.GetName(), err)
+	}
+	for _, version := range crd.Spec.Versions {
+		gvk := schema.GroupVersionKind{Group: crd.Spec.Group, Version: version.Name, Kind: crd.Spec.Names.Kind}
+		definition := &spec.Schema{}
+		if version.Schema != nil && version.Schema.OpenAPIV3Schema != nil {
+			data, err := json.Marshal(version.Schema.OpenAPIV3Schema)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(data, definition); err != nil {
+				return fmt.Errorf("invalid schema of CRD %s version %s: %w", crd.Name, version.Name, err)
+			}
+		}
+		name := "crd:" + gvk.String()
+		r.definitions[name] = definition
+		r.addKind(gvk, name)
+	}
+	return nil
+}
+
+// validate returns the schema violations of a resource, or errSchemaNotFound if its kind has no schema
+func (r *schemaRegistry) validate(resource *unstructured.Unstructured) ([]string, error) {
+	gvk := resource.GroupVersionKind()
+	validator, ok := r.validators[gvk]
+	if !ok {
+		name, found := r.kinds[gvk]
+		if !found {
+			return nil, fmt.Errorf("%w for %s %s", errSchemaNotFound, resource.GetAPIVersion(), gvk.Kind)
+		}
+		root := r.expand(r.definitions[name], map[string]bool{})
+		allowObjectFields(root)
+		validator = validate.NewSchemaValidator(root, nil, "", strfmt.Default)
+		r.validators[gvk] = validator
+	}
+
+	var violations []string
+	for _, err := range validator.Validate(resource.Object).Errors {
+		// The violations of the allOf members are reported on their own
+		if strings.Contains(err.Error(), "must validate all the schemas (allOf)") {
+			continue
+		}
+		violations = append(violations, violationMessage(err))
+	}
+	sort.Strings(violations)
+	return violations, nil
+}
+
+// isKnownGroup returns true if there are schemas for the API group, so that a kind without a schema in this
+// group is an error rather than a custom resource whose CRD is missing
+func (r *schemaRegistry) isKnownGroup(group string) bool {
+	return r.groups[group]
+}
+
+// violationMessage returns the message of a schema violation, reporting undeclared fields like kubectl does
+func violationMessage(err error) string {
+	var validation *openapierrors.Validation
+	if v, ok := err.(*openapierrors.Validation); ok {
+		validation = v
+	}
+	if validation != nil && validation.Code() == openapierrors.UnallowedPropertyCode {
+		return fmt.Sprintf("unknown field \"%s\"", strings.TrimPrefix(validation.Name+"."+fmt.Sprint(validation.Value), "."))
+	}
+	return strings.Replace(strings.TrimPrefix(err.Error(), "."), " in body ", " ", 1)
+}
+
+// allowObjectFields declares the fields of every object in the root schema of a kind, which the CRD schemas
+// are not required to declare
+func allowObjectFields(root *spec.Schema) {
+	if root.AdditionalProperties == nil || root.AdditionalProperties.Allows {
+		return
+	}
+	for _, field := range []string{"apiVersion", "kind", "metadata"} {
+		if _, ok := root.Properties[field]; !ok {
+			root.Properties[field] = spec.Schema{}
+		}
+	}
+}
+
+// expand returns a copy of a schema with its references replaced by the definitions they point to, so that it
+// can be validated against. Recursive references accept any value. Like the API server, null values are
+// accepted everywhere, and the fields of objects declaring their properties are restricted to them unless
+// unknown fields are preserved.
+func (r *schemaRegistry) expand(s *spec.Schema, expanding map[string]bool) *spec.Schema {
+	if s == nil {
+		return nil
+	}
+	if ref := s.Ref.String(); ref != "" {
+		name := ref
+		for _, prefix := range definitionRefPrefixes {
+			name = strings.TrimPrefix(name, prefix)
+		}
+		definition := r.definitions[name]
+		// OpenAPI v2 documents declare quantities as strings, though numbers are accepted too
+		if definition == nil || expanding[name] || strings.HasSuffix(name, "pkg.api.resource.Quantity") {
+			return &spec.Schema{SchemaProps: spec.SchemaProps{Nullable: true}}
+		}
+		expanding[name] = true
+		defer delete(expanding, name)
+		return r.expand(definition, expanding)
+	}
+
+	expanded := *s
+	expanded.Nullable = true
+	// OpenAPI v2 documents declare int-or-strings as strings
+	if expanded.Format == "int-or-string" {
+		expanded.Type = nil
+	}
+	expanded.Definitions = nil
+	expanded.Properties = r.expandMap(s.Properties, expanding)
+	expanded.PatternProperties = r.expandMap(s.PatternProperties, expanding)
+	expanded.AllOf = r.expandSlice(s.AllOf, expanding)
+	expanded.AnyOf = r.expandSlice(s.AnyOf, expanding)
+	expanded.OneOf = r.expandSlice(s.OneOf, expanding)
+	expanded.Not = r.expand(s.Not, expanding)
+	if s.Items != nil {
+		expanded.Items = &spec.SchemaOrArray{
+			Schema:  r.expand(s.Items.Schema, expanding),
+			Schemas: r.expandSlice(s.Items.Schemas, expanding),
+		}
+	}
+	if s.AdditionalProperties != nil {
+		expanded.AdditionalProperties = &spec.SchemaOrBool{
+			Allows: s.AdditionalProperties.Allows,
+			Schema: r.expand(s.AdditionalProperties.Schema, expanding),
+		}
+	} else if len(s.Properties) > 0 && !preservesUnknownFields(s) {
+		expanded.AdditionalProperties = &spec.SchemaOrBool{Allows: false}
+	}
+	return &expanded
+}
+
+// expandMap expands the schemas of a map of schemas
+func (r *schemaRegistry) expandMap(schemas map[string]spec.Schema, expanding map[string]bool) map[string]spec.Schema {
+	if schemas == nil {
+		return nil
+	}
+	expanded := make(map[string]spec.Schema, len(schemas))
+	for key, s := range schemas {
+		expanded[key] = *r.expand(&s, expanding)
+	}
+	return expanded
+}
+
+// expandSlice expands the schemas of a list of schemas
+func (r *schemaRegistry) expandSlice(schemas []spec.Schema, expanding map[string]bool) []spec.Schema {
+	if schemas == nil {
+		return nil
+	}
+	expanded := make([]spec.Schema, 0, len(schemas))
+	for i := range schemas {
+		expanded = append(expanded, *r.expand(&schemas[i], expanding))
+	}
+	return expanded
+}
+
+// preservesUnknownFields returns true if a schema accepts fields it does not declare
+func preservesUnknownFields(s *spec.Schema) bool {
+	for key, value := range s.Extensions {
+		if strings.EqualFold(key, extensionPreserveUnknownField) {
+			preserve, _ := value.(bool)
+			return preserve
+		}
+	}
+	return false
+}
+
+// LoadCRDs loads the CustomResourceDefinitions of a manifest file
+func LoadCRDs(filename string) ([]*unstructured.Unstructured, error) {
+	manifests, err := loadManifestsFile(filename, "CRDs")
+	if err != nil {
+		return nil, err
+	}
+	var crds []*unstructured.Unstructured
+	for _, manifest := range manifests {
+		if kube.IsCRD(manifest) {
+			crds = append(crds, manifest)
+		}
+	}
+	if len(crds) == 0 {
+		return nil, fmt.Errorf("no CustomResourceDefinition found in %s", filename)
+	}
+	return crds, nil
+}
@@ -0,0 +1,207 @@
+package preview
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const widgetCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+  - name: v1
+    served: true
+    storage: true
+    schema:
+      openAPIV3Schema:
+        type: object
+        properties:
+          spec:
+            type: object
+            required: [size]
+            properties:
+              size:
+                type: string
+                enum: [small, large]
+              extra:
+                type: object
+                x-kubernetes-preserve-unknown-fields: true
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: ignored
+`
+
+// newTestSchemaRegistry returns a registry holding the bundled schemas
+func newTestSchemaRegistry(t *testing.T) *schemaRegistry {
+	t.Helper()
+	registry, err := newSchemaRegistry("")
+	require.NoError(t, err)
+	return registry
+}
+
+// TestValidateBundledSchemas verifies that the built-in resources are validated against the bundled schemas
+func TestValidateBundledSchemas(t *testing.T) {
+	registry := newTestSchemaRegistry(t)
+	resources := mustParseManifests(t,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"valid"},"data":{"a":"1"}}`,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web"},
+		"spec":{"replicas":"3","selector":{},"template":{"spec":{"containers":[{"image":"nginx"}]}},"bogus":true}}`,
+		`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"creds"},"data":{"password":"not base64!"}}`,
+		`{"apiVersion":"v1","kind":"Pod","metadata":{"name":"web"},
+		"spec":{"containers":[{"name":"web","resources":{"limits":{"cpu":"500m","memory":1024}}}]}}`,
+	)
+
+	violations, err := registry.validate(resources[0])
+	require.NoError(t, err)
+	require.Empty(t, violations)
+
+	violations, err = registry.validate(resources[1])
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"spec.replicas must be of type integer: \"string\"",
+		"spec.template.spec.containers[0].name is required",
+		"unknown field \"spec.bogus\"",
+	}, violations)
+
+	violations, err = registry.validate(resources[2])
+	require.NoError(t, err)
+	require.Len(t, violations, 1)
+	require.Contains(t, violations[0], "data.password")
+
+	violations, err = registry.validate(resources[3])
+	require.NoError(t, err)
+	require.Empty(t, violations)
+}
+
+// TestValidateUnknownKinds verifies that the kinds without a schema are told apart from the custom resources
+func TestValidateUnknownKinds(t *testing.T) {
+	registry := newTestSchemaRegistry(t)
+	resources := mustParseManifests(t,
+		`{"apiVersion":"apps/v2","kind":"Deployment","metadata":{"name":"web"}}`,
+		`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"w"}}`,
+	)
+
+	_, err := registry.validate(resources[0])
+	require.ErrorIs(t, err, errSchemaNotFound)
+	require.EqualError(t, err, "no schema found for apps/v2 Deployment")
+	require.True(t, registry.isKnownGroup("apps"))
+
+	_, err = registry.validate(resources[1])
+	require.ErrorIs(t, err, errSchemaNotFound)
+	require.False(t, registry.isKnownGroup("example.com"))
+}
+
+// TestValidateCRDs verifies that custom resources are validated against the schemas of their CRD
+func TestValidateCRDs(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "crds.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(widgetCRD), 0o600))
+	crds, err := LoadCRDs(filename)
+	require.NoError(t, err)
+	require.Len(t, crds, 1)
+
+	registry := newTestSchemaRegistry(t)
+	require.NoError(t, registry.addCRD(crds[0]))
+	resources := mustParseManifests(t,
+		`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"valid"},
+		"spec":{"size":"small","extra":{"anything":1}}}`,
+		`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"invalid"},"spec":{"size":"huge","color":1}}`,
+	)
+
+	violations, err := registry.validate(resources[0])
+	require.NoError(t, err)
+	require.Empty(t, violations)
+
+	violations, err = registry.validate(resources[1])
+	require.NoError(t, err)
+	require.Len(t, violations, 2)
+	require.Contains(t, violations[0], "spec.size should be one of [small large]")
+	require.Equal(t, "unknown field \"spec.color\"", violations[1])
+
+	require.NoError(t, os.WriteFile(filename, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n"), 0o600))
+	_, err = LoadCRDs(filename)
+	require.ErrorContains(t, err, "no CustomResourceDefinition found")
+}
+
+// TestSchemaDir verifies that the schemas of a directory of OpenAPI documents replace the bundled ones
+func TestSchemaDir(t *testing.T) {
+	dir := t.TempDir()
+	document := `{"components":{"schemas":{
+		"io.k8s.api.core.v1.ConfigMap":{
+			"type":"object",
+			"properties":{
+				"apiVersion":{"type":"string"},
+				"kind":{"type":"string"},
+				"metadata":{"$ref":"#/components/schemas/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"},
+				"data":{"type":"object","additionalProperties":{"type":"string"}}
+			},
+			"x-kubernetes-group-version-kind":[{"group":"","kind":"ConfigMap","version":"v1"}]
+		},
+		"io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta":{
+			"type":"object",
+			"properties":{"name":{"type":"string"}}
+		}
+	}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api__v1_openapi.json"), []byte(document), 0o600))
+
+	registry, err := newSchemaRegistry(dir)
+	require.NoError(t, err)
+	resources := mustParseManifests(t,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings","uid":"1"},"data":{"a":1}}`,
+		`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"creds"}}`,
+	)
+
+	violations, err := registry.validate(resources[0])
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"data.a must be of type string: \"integer\"",
+		"unknown field \"metadata.uid\"",
+	}, violations)
+
+	_, err = registry.validate(resources[1])
+	require.ErrorIs(t, err, errSchemaNotFound)
+
+	_, err = newSchemaRegistry(t.TempDir())
+	require.ErrorContains(t, err, "no OpenAPI document")
+}
+
+// TestPrintValidationResult verifies that the violations are reported by Application and resource
+func TestPrintValidationResult(t *testing.T) {
+	registry := newTestSchemaRegistry(t)
+	apps := []argoappv1.Application{
+		{ObjectMeta: metav1.ObjectMeta{Name: "web"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "db"}},
+	}
+	rendered := [][]*unstructured.Unstructured{
+		mustParseManifests(t,
+			`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","namespace":"prod"},
+			"spec":{"ports":[{"port":"http"}]}}`,
+			`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"w"}}`,
+		),
+		mustParseManifests(t, `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"db"}}`),
+	}
+
+	result := validateRenderedResources(registry, apps, rendered, mustCompileFilter(t, ResourceFilter{}))
+	var buf bytes.Buffer
+	require.NoError(t, printValidationResult(&buf, result))
+	require.Equal(t, `APP   KIND      NAMESPACE   NAME   ERROR
+web   Service   prod        web    spec.ports[0].port must be of type integer: "string"
+
+2 resource(s) validated, 1 invalid, 1 skipped without a schema
+`, buf.String())
+}
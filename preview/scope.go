@@ -0,0 +1,68 @@
+package preview
+
+import (
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// clusterScopedKinds are the built-in kinds that are not namespaced. Without an API server to discover them,
+// the other kinds are assumed to be namespaced, unless a CRD rendered along says otherwise.
+var clusterScopedKinds = map[schema.GroupKind]bool{
+	{Group: "", Kind: "ComponentStatus"}:                                              true,
+	{Group: "", Kind: "Namespace"}:                                                    true,
+	{Group: "", Kind: "Node"}:                                                         true,
+	{Group: "", Kind: "PersistentVolume"}:                                             true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingAdmissionPolicy"}:          true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingAdmissionPolicyBinding"}:   true,
+	{Group: "admissionregistration.k8s.io", Kind: "MutatingWebhookConfiguration"}:     true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicy"}:        true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingAdmissionPolicyBinding"}: true,
+	{Group: "admissionregistration.k8s.io", Kind: "ValidatingWebhookConfiguration"}:   true,
+	{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}:                 true,
+	{Group: "apiregistration.k8s.io", Kind: "APIService"}:                             true,
+	{Group: "certificates.k8s.io", Kind: "CertificateSigningRequest"}:                 true,
+	{Group: "certificates.k8s.io", Kind: "ClusterTrustBundle"}:                        true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "FlowSchema"}:                       true,
+	{Group: "flowcontrol.apiserver.k8s.io", Kind: "PriorityLevelConfiguration"}:       true,
+	{Group: "networking.k8s.io", Kind: "IngressClass"}:                                true,
+	{Group: "networking.k8s.io", Kind: "IPAddress"}:                                   true,
+	{Group: "networking.k8s.io", Kind: "ServiceCIDR"}:                                 true,
+	{Group: "node.k8s.io", Kind: "RuntimeClass"}:                                      true,
+	{Group: "policy", Kind: "PodSecurityPolicy"}:                                      true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRole"}:                         true,
+	{Group: "rbac.authorization.k8s.io", Kind: "ClusterRoleBinding"}:                  true,
+	{Group: "resource.k8s.io", Kind: "DeviceClass"}:                                   true,
+	{Group: "scheduling.k8s.io", Kind: "PriorityClass"}:                               true,
+	{Group: "storage.k8s.io", Kind: "CSIDriver"}:                                      true,
+	{Group: "storage.k8s.io", Kind: "CSINode"}:                                        true,
+	{Group: "storage.k8s.io", Kind: "StorageClass"}:                                   true,
+	{Group: "storage.k8s.io", Kind: "VolumeAttachment"}:                               true,
+}
+
+// resourceScopes tells whether the custom resource kinds defined by rendered CRDs are namespaced
+type resourceScopes map[schema.GroupKind]bool
+
+// newResourceScopes returns the scopes of the custom resource kinds defined by the CRDs among the resources
+func newResourceScopes(resources []*unstructured.Unstructured) resourceScopes {
+	scopes := resourceScopes{}
+	for _, resource := range resources {
+		if !kube.IsCRD(resource) {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(resource.Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(resource.Object, "spec", "names", "kind")
+		scope, _, _ := unstructured.NestedString(resource.Object, "spec", "scope")
+		scopes[schema.GroupKind{Group: group, Kind: kind}] = scope != string(apiextensionsv1.ClusterScoped)
+	}
+	return scopes
+}
+
+// isNamespaced returns true if the resources of the given kind are namespaced
+func (s resourceScopes) isNamespaced(gk schema.GroupKind) bool {
+	if namespaced, ok := s[gk]; ok {
+		return namespaced
+	}
+	return !clusterScopedKinds[gk]
+}
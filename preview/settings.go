@@ -0,0 +1,229 @@
+package preview
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/argoproj/argo-cd/v3/common"
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/reposerver/repository"
+	"github.com/argoproj/argo-cd/v3/util/argo"
+	"github.com/argoproj/argo-cd/v3/util/settings"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/yaml"
+)
+
+// argoCDNamespace is the namespace Argo CD is assumed to be installed in, where its settings are loaded into
+const argoCDNamespace = "argocd"
+
+// Repo server parameters of argocd-cmd-params-cm that change how manifests are generated
+const (
+	paramMaxCombinedDirectoryManifestsSize = "reposerver.max.combined.directory.manifests.size"
+	paramAllowOutOfBoundsSymlinks          = "reposerver.allow.oob.symlinks"
+	paramStreamedManifestMaxTarSize        = "reposerver.streamed.manifest.max.tar.size"
+	paramStreamedManifestMaxExtractedSize  = "reposerver.streamed.manifest.max.extracted.size"
+	paramHelmManifestMaxExtractedSize      = "reposerver.helm.manifest.max.extracted.size"
+	paramDisableHelmManifestMaxExtracted   = "reposerver.disable.helm.manifest.max.extracted.size"
+	paramEnableGitSubmodule                = "reposerver.enable.git.submodule"
+	paramIncludeHiddenDirectories          = "reposerver.include.hidden.directories"
+)
+
+// ArgoCDSettings holds the Argo CD settings read from the argocd-cm and argocd-cmd-params-cm ConfigMap manifests.
+// The zero value stands for no settings at all, not even the exclusions built into Argo CD.
+type ArgoCDSettings struct {
+	// ResourcesFilter holds the resource.exclusions and resource.inclusions settings. Nil excludes nothing.
+	ResourcesFilter *settings.ResourcesFilter
+	// KustomizeSettings holds the kustomize.buildOptions and kustomize.path settings. Nil means the defaults.
+	KustomizeSettings *settings.KustomizeSettings
+	// HelmOptions holds the helm.valuesFileSchemes setting
+	HelmOptions *argoappv1.HelmOptions
+	// EnabledSourceTypes holds the source types manifests can be generated for
+	EnabledSourceTypes map[string]bool
+	// TrackingMethod is the application.resourceTrackingMethod setting, annotation by default
+	TrackingMethod string
+	// AppInstanceLabelKey is the application.instanceLabelKey setting, app.kubernetes.io/instance by default
+	AppInstanceLabelKey string
+	// InstallationID is the installationID setting
+	InstallationID string
+	// ResourceOverrides holds the resource.customizations settings, used to compare resources
+	ResourceOverrides map[string]argoappv1.ResourceOverride
+	// IgnoreAggregatedRoles is the ignoreAggregatedRoles option of the resource.compareoptions setting
+	IgnoreAggregatedRoles bool
+	// RepoServerParams holds the argocd-cmd-params-cm parameters
+	RepoServerParams map[string]string
+}
+
+// LoadArgoCDSettings reads the settings of an argocd-cm ConfigMap manifest, and optionally the parameters of an
+// argocd-cmd-params-cm ConfigMap manifest, parsing them with the Argo CD settings manager so that they are
+// interpreted the same way the Argo CD server does. An empty filename stands for a ConfigMap without data.
+func LoadArgoCDSettings(configMapFile string, cmdParamsFile string) (*ArgoCDSettings, error) {
+	configMap, err := loadConfigMap(configMapFile)
+	if err != nil {
+		return nil, err
+	}
+	cmdParams, err := loadConfigMap(cmdParamsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	// The settings manager only watches the ConfigMaps of its namespace that are part of Argo CD
+	configMap.Name = common.ArgoCDConfigMapName
+	configMap.Namespace = argoCDNamespace
+	configMap.Labels = map[string]string{"app.kubernetes.io/part-of": "argocd"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	manager := settings.NewSettingsManager(ctx, fake.NewClientset(configMap), argoCDNamespace)
+
+	s := &ArgoCDSettings{RepoServerParams: cmdParams.Data}
+	if s.ResourcesFilter, err = manager.GetResourcesFilter(); err != nil {
+		return nil, fmt.Errorf("invalid Argo CD settings %s: %w", configMapFile, err)
+	}
+	if s.KustomizeSettings, err = manager.GetKustomizeSettings(); err != nil {
+		return nil, fmt.Errorf("invalid Argo CD settings %s: %w", configMapFile, err)
+	}
+	if s.HelmOptions, err = manager.GetHelmSettings(); err != nil {
+		return nil, fmt.Errorf("invalid Argo CD settings %s: %w", configMapFile, err)
+	}
+	if s.EnabledSourceTypes, err = manager.GetEnabledSourceTypes(); err != nil {
+		return nil, fmt.Errorf("invalid Argo CD settings %s: %w", configMapFile, err)
+	}
+	s.TrackingMethod = string(argo.GetTrackingMethod(manager))
+	if err := validateTrackingMethod(s.TrackingMethod); err != nil {
+		return nil, fmt.Errorf("invalid Argo CD settings %s: %w", configMapFile, err)
+	}
+	if s.AppInstanceLabelKey, err = manager.GetAppInstanceLabelKey(); err != nil {
+		return nil, fmt.Errorf("invalid Argo CD settings %s: %w", configMapFile, err)
+	}
+	if s.InstallationID, err = manager.GetInstallationID(); err != nil {
+		return nil, fmt.Errorf("invalid Argo CD settings %s: %w", configMapFile, err)
+	}
+	if s.ResourceOverrides, err = manager.GetResourceOverrides(); err != nil {
+		return nil, fmt.Errorf("invalid Argo CD settings %s: %w", configMapFile, err)
+	}
+	compareOptions, err := manager.GetResourceCompareOptions()
+	if err != nil {
+		return nil, fmt.Errorf("invalid Argo CD settings %s: %w", configMapFile, err)
+	}
+	s.IgnoreAggregatedRoles = compareOptions.IgnoreAggregatedRoles
+	return s, nil
+}
+
+// loadConfigMap reads a ConfigMap manifest, returning an empty ConfigMap when no filename is given
+func loadConfigMap(filename string) (*corev1.ConfigMap, error) {
+	configMap := &corev1.ConfigMap{}
+	if filename == "" {
+		return configMap, nil
+	}
+	data, err := os.ReadFile(filepath.Clean(filename))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Argo CD settings %s: %w", filename, err)
+	}
+	if err := yaml.Unmarshal(data, configMap); err != nil {
+		return nil, fmt.Errorf("failed to parse Argo CD settings %s: %w", filename, err)
+	}
+	if configMap.Kind != "ConfigMap" {
+		return nil, fmt.Errorf("%s is not a ConfigMap manifest", filename)
+	}
+	return configMap, nil
+}
+
+// isExcluded returns true if Argo CD ignores the resource on the given destination cluster,
+// according to the resource exclusions and inclusions
+func (s *ArgoCDSettings) isExcluded(resource *unstructured.Unstructured, cluster string) bool {
+	if s == nil || s.ResourcesFilter == nil {
+		return false
+	}
+	gvk := resource.GroupVersionKind()
+	return s.ResourcesFilter.IsExcludedResource(gvk.Group, gvk.Kind, cluster)
+}
+
+// applyRepoServerParams overrides the repo server constants with the argocd-cmd-params-cm parameters
+func (s *ArgoCDSettings) applyRepoServerParams(constants *repository.RepoServerInitConstants) error {
+	if s == nil {
+		return nil
+	}
+	for key, value := range s.RepoServerParams {
+		var err error
+		switch key {
+		case paramMaxCombinedDirectoryManifestsSize:
+			constants.MaxCombinedDirectoryManifestsSize, err = resource.ParseQuantity(value)
+		case paramAllowOutOfBoundsSymlinks:
+			constants.AllowOutOfBoundsSymlinks, err = strconv.ParseBool(value)
+		case paramStreamedManifestMaxTarSize:
+			constants.StreamedManifestMaxTarSize, err = parseQuantityValue(value)
+		case paramStreamedManifestMaxExtractedSize:
+			constants.StreamedManifestMaxExtractedSize, err = parseQuantityValue(value)
+		case paramHelmManifestMaxExtractedSize:
+			constants.HelmManifestMaxExtractedSize, err = parseQuantityValue(value)
+		case paramDisableHelmManifestMaxExtracted:
+			constants.DisableHelmManifestMaxExtractedSize, err = strconv.ParseBool(value)
+		case paramEnableGitSubmodule:
+			constants.SubmoduleEnabled, err = strconv.ParseBool(value)
+		case paramIncludeHiddenDirectories:
+			constants.IncludeHiddenDirectories, err = strconv.ParseBool(value)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid value '%s' of parameter %s: %w", value, key, err)
+		}
+	}
+	return nil
+}
+
+// parseQuantityValue parses a quantity (e.g. 1G) into its integer value
+func parseQuantityValue(value string) (int64, error) {
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return 0, err
+	}
+	return quantity.ToDec().Value(), nil
+}
+
+// kustomizeOptions returns the Kustomize build options and binary of an Application source,
+// or nil when no Kustomize settings are loaded
+func (s *ArgoCDSettings) kustomizeOptions(source argoappv1.ApplicationSource) (*argoappv1.KustomizeOptions, error) {
+	if s == nil || s.KustomizeSettings == nil {
+		return nil, nil
+	}
+	return s.KustomizeSettings.GetOptions(source)
+}
+
+// liveDiffConfig is how the resources of Applications are tracked and compared with their live state
+type liveDiffConfig struct {
+	method                argoappv1.TrackingMethod
+	labelKey              string
+	installationID        string
+	overrides             map[string]argoappv1.ResourceOverride
+	ignoreAggregatedRoles bool
+}
+
+// liveDiffConfig returns how resources are compared with their live state, falling back to the Argo CD
+// defaults for the settings that are not set
+func (s *ArgoCDSettings) liveDiffConfig() liveDiffConfig {
+	config := liveDiffConfig{
+		method:    argo.TrackingMethodAnnotation,
+		labelKey:  common.LabelKeyAppInstance,
+		overrides: map[string]argoappv1.ResourceOverride{},
+	}
+	if s == nil {
+		return config
+	}
+	if s.TrackingMethod != "" {
+		config.method = argoappv1.TrackingMethod(s.TrackingMethod)
+	}
+	if s.AppInstanceLabelKey != "" {
+		config.labelKey = s.AppInstanceLabelKey
+	}
+	if s.ResourceOverrides != nil {
+		config.overrides = s.ResourceOverrides
+	}
+	config.installationID = s.InstallationID
+	config.ignoreAggregatedRoles = s.IgnoreAggregatedRoles
+	return config
+}
@@ -0,0 +1,206 @@
+package preview
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/argo-cd/v3/reposerver/repository"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const argoCDConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: argocd-cm
+data:
+  resource.exclusions: |
+    - apiGroups:
+      - cilium.io
+      kinds:
+      - CiliumIdentity
+      clusters:
+      - "*"
+    - apiGroups:
+      - "*"
+      kinds:
+      - Secret
+      clusters:
+      - https://prod.example.com
+`
+
+// writeArgoCDConfigMap writes an argocd-cm manifest to a temporary file
+func writeArgoCDConfigMap(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "argocd-cm.yaml")
+	require.NoError(t, os.WriteFile(filename, []byte(content), 0o600))
+	return filename
+}
+
+// TestLoadArgoCDSettings verifies that resource exclusions are applied per destination cluster,
+// along with the exclusions built into Argo CD
+func TestLoadArgoCDSettings(t *testing.T) {
+	settings, err := LoadArgoCDSettings(writeArgoCDConfigMap(t, argoCDConfigMap), "")
+	require.NoError(t, err)
+
+	resources := mustParseManifests(t,
+		`{"apiVersion":"cilium.io/v2","kind":"CiliumIdentity","metadata":{"name":"id"}}`,
+		`{"apiVersion":"v1","kind":"Secret","metadata":{"name":"token"}}`,
+		`{"apiVersion":"v1","kind":"Event","metadata":{"name":"event"}}`,
+		`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings"}}`,
+	)
+	require.True(t, settings.isExcluded(resources[0], "https://staging.example.com"))
+	require.False(t, settings.isExcluded(resources[1], "https://staging.example.com"))
+	require.True(t, settings.isExcluded(resources[1], "https://prod.example.com"))
+	require.True(t, settings.isExcluded(resources[2], "https://staging.example.com"))
+	require.False(t, settings.isExcluded(resources[3], "https://prod.example.com"))
+
+	var noSettings *ArgoCDSettings
+	require.False(t, noSettings.isExcluded(resources[2], ""))
+
+	renderer := newTestRenderer(t, Options{Settings: settings})
+	app := argoappv1.Application{}
+	app.Name = "web"
+	app.Spec.Destination.Server = "https://prod.example.com"
+	require.Equal(t, []string{"ConfigMap/settings"}, resourceNames(renderer.dropExcludedResources(app, resources)))
+}
+
+// TestLoadArgoCDSettingsInvalid verifies that manifests that are not valid argocd-cm ConfigMaps are rejected
+func TestLoadArgoCDSettingsInvalid(t *testing.T) {
+	_, err := LoadArgoCDSettings(writeArgoCDConfigMap(t, "apiVersion: v1\nkind: Secret\n"), "")
+	require.ErrorContains(t, err, "is not a ConfigMap manifest")
+
+	_, err = LoadArgoCDSettings(writeArgoCDConfigMap(t,
+		"apiVersion: v1\nkind: ConfigMap\ndata:\n  resource.exclusions: not a list\n"), "")
+	require.ErrorContains(t, err, "invalid Argo CD settings")
+
+	_, err = LoadArgoCDSettings(filepath.Join(t.TempDir(), "missing.yaml"), "")
+	require.ErrorContains(t, err, "failed to read Argo CD settings")
+}
+
+const argoCDServerConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: argocd-cm
+data:
+  kustomize.buildOptions: --enable-helm
+  kustomize.path.v5.4.3: /usr/local/bin/kustomize-v5.4.3
+  kustomize.buildOptions.v5.4.3: --load-restrictor LoadRestrictionsNone
+  helm.valuesFileSchemes: https, secrets
+  kustomize.enable: "false"
+  application.resourceTrackingMethod: label
+  application.instanceLabelKey: example.com/app
+  installationID: my-argocd
+  resource.customizations.ignoreDifferences.apps_Deployment: |
+    jsonPointers:
+    - /spec/replicas
+`
+
+const argoCDCmdParamsConfigMap = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: argocd-cmd-params-cm
+data:
+  reposerver.max.combined.directory.manifests.size: 10M
+  reposerver.include.hidden.directories: "true"
+`
+
+// TestLoadArgoCDServerSettings verifies that the settings are passed to the repo server with every manifest request
+func TestLoadArgoCDServerSettings(t *testing.T) {
+	settings, err := LoadArgoCDSettings(writeArgoCDConfigMap(t, argoCDServerConfigMap),
+		writeArgoCDConfigMap(t, argoCDCmdParamsConfigMap))
+	require.NoError(t, err)
+	require.Equal(t, "label", settings.TrackingMethod)
+	require.Equal(t, "example.com/app", settings.AppInstanceLabelKey)
+	require.Contains(t, settings.ResourceOverrides, "apps/Deployment")
+
+	renderer := newTestRenderer(t, Options{Settings: settings})
+	require.Equal(t, "label", renderer.opts.TrackingMethod, "the tracking method defaults to the settings")
+	require.Equal(t, "example.com/app", renderer.appLabelKey())
+
+	app := argoappv1.Application{}
+	app.Name = "web"
+	source := &argoappv1.ApplicationSource{RepoURL: "https://example.com/repo.git", Path: "web"}
+	request, err := renderer.manifestRequest(app, source, &argoappv1.Repository{Repo: source.RepoURL})
+	require.NoError(t, err)
+	require.Equal(t, "--enable-helm", request.KustomizeOptions.BuildOptions)
+	require.Equal(t, []string{"https", "secrets"}, request.HelmOptions.ValuesFileSchemes)
+	require.False(t, request.EnabledSourceTypes["Kustomize"])
+	require.True(t, request.EnabledSourceTypes["Helm"])
+	require.Equal(t, "label", request.TrackingMethod)
+	require.Equal(t, "example.com/app", request.AppLabelKey)
+	require.Equal(t, "my-argocd", request.InstallationID)
+
+	source.Kustomize = &argoappv1.ApplicationSourceKustomize{Version: "v5.4.3"}
+	request, err = renderer.manifestRequest(app, source, &argoappv1.Repository{Repo: source.RepoURL})
+	require.NoError(t, err)
+	require.Equal(t, "/usr/local/bin/kustomize-v5.4.3", request.KustomizeOptions.BinaryPath)
+	require.Equal(t, "--load-restrictor LoadRestrictionsNone", request.KustomizeOptions.BuildOptions)
+
+	source.Kustomize.Version = "v4"
+	_, err = renderer.manifestRequest(app, source, &argoappv1.Repository{Repo: source.RepoURL})
+	require.ErrorContains(t, err, "kustomize version v4 is not registered")
+
+	renderer = newTestRenderer(t, Options{Settings: settings, TrackingMethod: "annotation"})
+	require.Equal(t, "annotation", renderer.opts.TrackingMethod, "the tracking method option takes precedence")
+}
+
+// TestZeroArgoCDSettings verifies that settings built without LoadArgoCDSettings stand for no settings
+func TestZeroArgoCDSettings(t *testing.T) {
+	settings := &ArgoCDSettings{}
+	renderer := newTestRenderer(t, Options{Settings: settings})
+	resource := mustParseManifests(t, `{"apiVersion":"v1","kind":"Secret","metadata":{"name":"token"}}`)[0]
+	require.False(t, settings.isExcluded(resource, "https://kubernetes.default.svc"))
+
+	app := argoappv1.Application{}
+	app.Name = "web"
+	source := &argoappv1.ApplicationSource{RepoURL: "https://example.com/repo.git", Path: "web"}
+	request, err := renderer.manifestRequest(app, source, &argoappv1.Repository{Repo: source.RepoURL})
+	require.NoError(t, err)
+	require.Nil(t, request.KustomizeOptions)
+	require.Nil(t, request.HelmOptions)
+	require.Equal(t, []*unstructured.Unstructured{resource},
+		renderer.dropExcludedResources(app, []*unstructured.Unstructured{resource}))
+}
+
+// TestApplyRepoServerParams verifies that the argocd-cmd-params-cm parameters override the repo server defaults
+func TestApplyRepoServerParams(t *testing.T) {
+	settings, err := LoadArgoCDSettings("", writeArgoCDConfigMap(t, argoCDCmdParamsConfigMap))
+	require.NoError(t, err)
+
+	var constants repository.RepoServerInitConstants
+	require.NoError(t, settings.applyRepoServerParams(&constants))
+	require.Equal(t, "10M", constants.MaxCombinedDirectoryManifestsSize.String())
+	require.True(t, constants.IncludeHiddenDirectories)
+
+	settings.RepoServerParams["reposerver.allow.oob.symlinks"] = "maybe"
+	require.ErrorContains(t, settings.applyRepoServerParams(&constants),
+		"invalid value 'maybe' of parameter reposerver.allow.oob.symlinks")
+}
+
+// TestDiffLiveSettings verifies that the live state is compared using the tracking method
+// and resource customizations of the settings
+func TestDiffLiveSettings(t *testing.T) {
+	settings, err := LoadArgoCDSettings(writeArgoCDConfigMap(t, argoCDServerConfigMap), "")
+	require.NoError(t, err)
+
+	app := argoappv1.Application{}
+	app.Name = "web"
+	desired := mustParseManifests(t,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"prod"},"spec":{"replicas":3}}`,
+	)
+	live := mustParseManifests(t,
+		`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"prod",`+
+			`"labels":{"example.com/app":"web"}},"spec":{"replicas":5}}`,
+		`{"apiVersion":"v1","kind":"Service","metadata":{"name":"old","namespace":"prod",`+
+			`"labels":{"example.com/app":"web"}}}`,
+	)
+
+	appDiff, err := DiffLive(app, desired, live, settings)
+	require.NoError(t, err)
+	require.Len(t, appDiff.Resources, 1, "the replicas are ignored and the label tracking is in sync")
+	require.Equal(t, "/Service/prod/old", appDiff.Resources[0].Key.String())
+	require.Equal(t, ChangeRemoved, appDiff.Resources[0].Change)
+}
@@ -2,30 +2,25 @@ package preview
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
 
-	argocmd "github.com/argoproj/argo-cd/v3/cmd/argocd/commands"
 	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
-	repoapiclient "github.com/argoproj/argo-cd/v3/reposerver/apiclient"
-	"github.com/argoproj/argo-cd/v3/reposerver/metrics"
-	"github.com/argoproj/argo-cd/v3/reposerver/repository"
-	"github.com/argoproj/argo-cd/v3/util/argo"
-	"github.com/argoproj/argo-cd/v3/util/git"
 	"github.com/argoproj/pkg/errors"
 	log "github.com/sirupsen/logrus"
-	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 const (
 	applicationAPIVersion = "argoproj.io/v1alpha1"
 	applicationKind       = "Application"
+	appProjectKind        = "AppProject"
+	localRevisionHead     = "HEAD"
 )
 
 // normalizeGitURL converts various Git URL formats to a comparable form
@@ -86,10 +81,15 @@ func isLocalRepository(repoURL string) (bool, string, error) {
 // resolveLocalRevision resolves a git revision to HEAD SHA for local repositories
 // This ensures ArgoCD uses the current working directory content
 func resolveLocalRevision(repoPath string) (string, error) {
-	cmd := exec.Command("git", "-C", repoPath, "rev-parse", "HEAD")
+	return resolveLocalRevisionAt(repoPath, localRevisionHead)
+}
+
+// resolveLocalRevisionAt resolves the given revision (branch, tag, SHA...) of a local repository to a commit SHA
+func resolveLocalRevisionAt(repoPath string, revision string) (string, error) {
+	cmd := exec.Command("git", "-C", repoPath, "rev-parse", "--verify", revision+"^{commit}")
 	output, err := cmd.Output()
 	if err != nil {
-		return "", fmt.Errorf("failed to resolve HEAD in %s: %w", repoPath, err)
+		return "", fmt.Errorf("failed to resolve %s in %s: %w", revision, repoPath, err)
 	}
 	return strings.TrimSpace(string(output)), nil
 }
@@ -106,85 +106,132 @@ func getCacheDir() string {
 	return filepath.Join(os.TempDir(), "_argocd-offline-cli")
 }
 
-// generateAndOutputManifests generates manifests for Applications and outputs them
-func generateAndOutputManifests(apps []argoappv1.Application, appName string, resKind string, output string) {
-	max, err := resource.ParseQuantity("100G")
-	errors.CheckError(err)
-	maxValue := max.ToDec().Value()
-	initConstants := repository.RepoServerInitConstants{
-		HelmManifestMaxExtractedSize:      maxValue,
-		HelmRegistryMaxIndexSize:          maxValue,
-		MaxCombinedDirectoryManifestsSize: max,
-		StreamedManifestMaxExtractedSize:  maxValue,
-		StreamedManifestMaxTarSize:        maxValue,
-	}
-
-	repoService := repository.NewService(
-		metrics.NewMetricsServer(),
-		NewNoopCache(),
-		initConstants,
-		argo.NewResourceTracking(),
-		git.NoopCredsStore{},
-		getCacheDir(),
-	)
-	if err := repoService.Init(); err != nil {
-		log.Fatal("failed to initialize the repo service: ", err)
-	}
-
-	for _, app := range apps {
-		// Skip apps that don't match the filter
-		if shouldMatch(appName) && appName != app.Name {
-			continue
+// generateAndOutputManifests generates manifests for Applications and outputs them, followed by the resources
+// rendered more than once, which are returned
+func generateAndOutputManifests(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	apps []argoappv1.Application,
+	appFilter AppFilter,
+	filter ResourceFilter,
+	order ResourceOrder,
+	output string,
+) []DuplicateResource {
+	errors.CheckError(order.validate())
+	selected := appFilter.mustCompile().selectApplications(apps)
+	matcher := filter.mustCompile()
+	renderer, err := NewRenderer(opts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer renderer.Close()
+
+	rendered, duplicates, err := renderer.renderApplicationSources(ctx, selected)
+	if err != nil {
+		log.Fatal(err)
+	}
+	outputManifests(w, selected, rendered, matcher, order, output)
+	errors.CheckError(printDuplicates(w, duplicates, output))
+	return duplicates
+}
+
+// outputManifests outputs the rendered resources of the Applications selected by the matcher
+func outputManifests(
+	w io.Writer,
+	apps []argoappv1.Application,
+	rendered []renderedSources,
+	matcher *resourceMatcher,
+	order ResourceOrder,
+	output string,
+) {
+	if isTemplateOutput(output) {
+		var resources []*unstructured.Unstructured
+		for _, sources := range rendered {
+			appResources := selectResources(sources.flatten(), matcher)
+			sortResources(appResources, order)
+			resources = append(resources, appResources...)
+		}
+		errors.CheckError(printTemplatedList(w, resources, output))
+		return
+	}
+
+	if output == outputFormatPlan {
+		var steps []planStep
+		for i, sources := range rendered {
+			steps = append(steps, syncPlan(apps[i].Name, selectResources(sources.flatten(), matcher))...)
 		}
+		errors.CheckError(printSyncPlan(w, steps))
+		return
+	}
 
-		manifests := generateAppManifests(repoService, app)
-		resources := filterResources(manifests, resKind)
-		printResources(resources, output)
+	if isTableOutput(output) {
+		var rows []resourceRow
+		for i, sources := range rendered {
+			rows = append(rows, resourceRows(apps[i].Name, sources, matcher, order)...)
+		}
+		errors.CheckError(printResourceTable(w, rows, output == outputFormatWide))
+		return
+	}
+
+	if dir, ok := strings.CutPrefix(output, outputFormatDirPrefix); ok {
+		errors.CheckError(checkApplicationDirs(dir, apps))
+		for i, sources := range rendered {
+			errors.CheckError(writeResourcesToDir(dir, apps[i].Name, filterResources(sources.flatten(), matcher)))
+		}
+		return
+	}
+
+	for _, sources := range rendered {
+		if order == OrderKind {
+			printResources(w, filterResources(sources.flatten(), matcher), output)
+			continue
+		}
+		resources := selectResources(sources.flatten(), matcher)
+		sortResources(resources, order)
+		printSortedResources(w, resources, output)
 	}
 }
 
-// generateAppManifests generates manifests for a single application
-func generateAppManifests(repoService *repository.Service, app argoappv1.Application) []string {
+// generateAppManifests generates manifests for a single application, by source index
+func (r *Renderer) generateAppManifests(ctx context.Context, app argoappv1.Application) ([][]string, error) {
 	// Normalize source handling using ArgoCD v3 helper methods
 	sources := app.Spec.GetSources() // Normalize to array
 	if len(sources) == 0 {
-		log.Fatalf("Application '%s' has no source configured (.spec.source or .spec.sources)", app.Name)
+		return nil, fmt.Errorf("application '%s' has no source configured (.spec.source or .spec.sources)", app.Name)
 	}
 
-	var manifests []string
-	var err error
-
 	if app.Spec.HasMultipleSources() {
 		// Multi-source path
-		manifests, err = generateMultiSourceManifests(repoService, app)
-		if err != nil {
-			log.Fatalf("Failed to generate manifests for multi-source app '%s': %v", app.Name, err)
-		}
-	} else {
-		// Single-source path (existing logic)
-		manifests, err = generateSingleSourceManifest(repoService, app)
+		manifests, err := r.generateMultiSourceManifests(ctx, app)
 		if err != nil {
-			log.Fatalf("Failed to generate manifests for app '%s': %v", app.Name, err)
+			return nil, fmt.Errorf("failed to generate manifests for multi-source app '%s': %w", app.Name, err)
 		}
+		return manifests, nil
 	}
 
-	return manifests
+	// Single-source path (existing logic)
+	manifests, err := r.generateSingleSourceManifest(ctx, app)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate manifests for app '%s': %w", app.Name, err)
+	}
+	return [][]string{manifests}, nil
 }
 
-// filterResources parses manifests and filters by resource kind
-func filterResources(manifests []string, resKind string) map[string][]unstructured.Unstructured {
+// filterResources groups the resources selected by the matcher by lowercased kind
+func filterResources(
+	manifests []*unstructured.Unstructured,
+	matcher *resourceMatcher,
+) map[string][]unstructured.Unstructured {
 	resources := map[string][]unstructured.Unstructured{}
 
 	for _, manifest := range manifests {
-		resource := unstructured.Unstructured{}
-		err := json.Unmarshal([]byte(manifest), &resource)
-		errors.CheckError(err)
-
-		kind := strings.ToLower(resource.GetKind())
-		if shouldMatch(resKind) && resKind != kind {
+		if !matcher.matches(manifest) {
 			continue
 		}
 
+		resource := *manifest
+		kind := strings.ToLower(resource.GetKind())
 		if _, ok := resources[kind]; !ok {
 			resources[kind] = make([]unstructured.Unstructured, 0)
 		}
@@ -194,8 +241,40 @@ func filterResources(manifests []string, resKind string) map[string][]unstructur
 	return resources
 }
 
+// selectResources returns the resources selected by the matcher
+func selectResources(manifests []*unstructured.Unstructured, matcher *resourceMatcher) []*unstructured.Unstructured {
+	resources := make([]*unstructured.Unstructured, 0, len(manifests))
+	for _, manifest := range manifests {
+		if matcher.matches(manifest) {
+			resources = append(resources, manifest)
+		}
+	}
+	return resources
+}
+
+// printSortedResources outputs resources in the specified format, as a single list keeping their order
+func printSortedResources(w io.Writer, resources []*unstructured.Unstructured, output string) {
+	switch output {
+	case outputFormatName:
+		fmt.Fprintln(w, "NAME")
+		for _, resource := range resources {
+			fmt.Fprintf(w, "%s/%s\n", strings.ToLower(resource.GetKind()), resource.GetName())
+		}
+	case outputFormatJSON, outputFormatYAML:
+		list := make([]unstructured.Unstructured, 0, len(resources))
+		for _, resource := range resources {
+			list = append(list, *resource)
+		}
+		if err := printResourceList(w, list, output); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		errors.CheckError(fmt.Errorf("unknown output format: %s", output))
+	}
+}
+
 // printResources outputs resources in the specified format
-func printResources(resources map[string][]unstructured.Unstructured, output string) {
+func printResources(w io.Writer, resources map[string][]unstructured.Unstructured, output string) {
 	kinds := make([]string, 0, len(resources))
 	for kind := range resources {
 		kinds = append(kinds, kind)
@@ -203,11 +282,11 @@ func printResources(resources map[string][]unstructured.Unstructured, output str
 	sort.Strings(kinds)
 
 	switch output {
-	case "name":
-		printResourceNames(kinds, resources)
-	case "json", "yaml":
+	case outputFormatName:
+		printResourceNames(w, kinds, resources)
+	case outputFormatJSON, outputFormatYAML:
 		for _, kind := range kinds {
-			if err := argocmd.PrintResourceList(resources[kind], output, false); err != nil {
+			if err := printResourceList(w, resources[kind], output); err != nil {
 				log.Fatal(err)
 			}
 		}
@@ -217,20 +296,20 @@ func printResources(resources map[string][]unstructured.Unstructured, output str
 }
 
 // printResourceNames prints resources in name format
-func printResourceNames(kinds []string, resources map[string][]unstructured.Unstructured) {
+func printResourceNames(w io.Writer, kinds []string, resources map[string][]unstructured.Unstructured) {
 	for i, kind := range kinds {
 		if i > 0 {
-			fmt.Println()
+			fmt.Fprintln(w)
 		}
-		fmt.Println("NAME")
+		fmt.Fprintln(w, "NAME")
 		for _, resource := range resources[kind] {
-			fmt.Printf("%s/%s\n", kind, resource.GetName())
+			fmt.Fprintf(w, "%s/%s\n", kind, resource.GetName())
 		}
 	}
 }
 
 // generateSingleSourceManifest handles manifest generation for traditional single-source applications
-func generateSingleSourceManifest(repoService *repository.Service, app argoappv1.Application) ([]string, error) {
+func (r *Renderer) generateSingleSourceManifest(ctx context.Context, app argoappv1.Application) ([]string, error) {
 	if app.Spec.Source == nil || app.Spec.Source.RepoURL == "" {
 		return nil, fmt.Errorf("application has no valid source configuration")
 	}
@@ -244,14 +323,14 @@ func generateSingleSourceManifest(repoService *repository.Service, app argoappv1
 	if isLocal {
 		log.Infof("Detected local repository for %s, using path: %s", app.Name, localPath)
 
-		// Resolve to HEAD for local repositories
-		resolvedRevision, err := resolveLocalRevision(localPath)
+		// Resolve to HEAD (or the configured local revision) for local repositories
+		resolvedRevision, err := resolveLocalRevisionAt(localPath, r.opts.LocalRevision)
 		if err != nil {
 			// Intentionally use original value when resolution fails to allow
 			// graceful fallback for edge cases
 			log.Warnf("Failed to resolve local revision: %v, using original", err)
 		} else {
-			log.Debugf("Resolved targetRevision to HEAD: %s", resolvedRevision)
+			log.Debugf("Resolved targetRevision to %s: %s", r.opts.LocalRevision, resolvedRevision)
 			// Create a copy with resolved revision to avoid modifying original
 			sourceCopy := app.Spec.Source.DeepCopy()
 			sourceCopy.TargetRevision = resolvedRevision
@@ -266,21 +345,19 @@ func generateSingleSourceManifest(repoService *repository.Service, app argoappv1
 	} else {
 		// Use existing credential resolution
 		log.Debugf("Using remote repository for %s: %s", app.Name, app.Spec.Source.RepoURL)
+		username, password := r.opts.Credentials(app.Spec.Source.RepoURL)
 		repoOverride = &argoappv1.Repository{
 			Repo:     app.Spec.Source.RepoURL,
-			Username: FindRepoUsername(app.Spec.Source.RepoURL),
-			Password: FindRepoPassword(app.Spec.Source.RepoURL),
+			Username: username,
+			Password: password,
 		}
 	}
 
-	response, err := repoService.GenerateManifest(context.Background(), &repoapiclient.ManifestRequest{
-		ApplicationSource: applicationSource,
-		AppName:           app.Name,
-		Namespace:         app.Spec.Destination.Namespace,
-		NoCache:           true,
-		Repo:              repoOverride,
-		ProjectName:       "applications",
-	})
+	request, err := r.manifestRequest(app, applicationSource, repoOverride)
+	if err != nil {
+		return nil, err
+	}
+	response, err := r.generateManifest(ctx, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate manifests: %w", err)
 	}
@@ -319,11 +396,12 @@ func validateGitSourcesConstraint(sources []argoappv1.ApplicationSource) error {
 	return nil
 }
 
-// resolveLocalRevisions resolves targetRevision to HEAD for local repositories
+// resolveLocalRevisions resolves targetRevision to the given local revision (usually HEAD) for local repositories
 // Returns the resolved sources and their local paths
 func resolveLocalRevisions(
 	sources []argoappv1.ApplicationSource,
 	appName string,
+	revision string,
 ) ([]argoappv1.ApplicationSource, []string) {
 	resolvedSources := make([]argoappv1.ApplicationSource, len(sources))
 	localPaths := make([]string, len(sources))
@@ -340,14 +418,14 @@ func resolveLocalRevisions(
 		log.Infof("Detected local repository for source %d in %s, using path: %s", i, appName, localPath)
 		localPaths[i] = localPath
 
-		resolvedRevision, err := resolveLocalRevision(localPath)
+		resolvedRevision, err := resolveLocalRevisionAt(localPath, revision)
 		if err != nil {
 			// Intentionally use original value when resolution fails to allow graceful fallback
 			log.Warnf("Failed to resolve local revision: %v, using original", err)
 			continue
 		}
 
-		log.Debugf("Resolved targetRevision to HEAD: %s", resolvedRevision)
+		log.Debugf("Resolved targetRevision to %s: %s", revision, resolvedRevision)
 		resolvedSources[i].TargetRevision = resolvedRevision
 	}
 
@@ -355,7 +433,7 @@ func resolveLocalRevisions(
 }
 
 // createRepoOverride creates a repository override for a source
-func createRepoOverride(
+func (r *Renderer) createRepoOverride(
 	sourceCopy argoappv1.ApplicationSource,
 	localPath string,
 	sourceIndex int,
@@ -371,16 +449,18 @@ func createRepoOverride(
 
 	// Repository credentials are resolved per-source using the source's repoURL
 	log.Debugf("Using remote repository for source %d in %s: %s", sourceIndex, appName, sourceCopy.RepoURL)
+	username, password := r.opts.Credentials(sourceCopy.RepoURL)
 	return &argoappv1.Repository{
 		Repo:     sourceCopy.RepoURL,
-		Username: FindRepoUsername(sourceCopy.RepoURL),
-		Password: FindRepoPassword(sourceCopy.RepoURL),
+		Username: username,
+		Password: password,
 	}
 }
 
 // Constraint: all Git repository sources must use the same repository URL
 // Helm chart sources (with Chart field set) are allowed to use different repositories
-func generateMultiSourceManifests(repoService *repository.Service, app argoappv1.Application) ([]string, error) {
+// Returns the manifests by source index
+func (r *Renderer) generateMultiSourceManifests(ctx context.Context, app argoappv1.Application) ([][]string, error) {
 	sources := app.Spec.GetSources()
 	if len(sources) == 0 {
 		return nil, fmt.Errorf("no sources found in multi-source application")
@@ -391,30 +471,26 @@ func generateMultiSourceManifests(repoService *repository.Service, app argoappv1
 	}
 
 	// Resolve local revisions and build refSources with resolved values
-	resolvedSources, localPaths := resolveLocalRevisions(sources, app.Name)
+	resolvedSources, localPaths := resolveLocalRevisions(sources, app.Name, r.opts.LocalRevision)
 	refSources := buildRefSources(resolvedSources)
 
 	// Generate manifests for each source
-	var allManifests []string
+	allManifests := make([][]string, 0, len(sources))
 	for i := range sources {
 		sourceCopy := resolvedSources[i]
-		repoOverride := createRepoOverride(sourceCopy, localPaths[i], i, app.Name)
-
-		response, err := repoService.GenerateManifest(context.Background(), &repoapiclient.ManifestRequest{
-			ApplicationSource:  &sourceCopy,
-			AppName:            app.Name,
-			Namespace:          app.Spec.Destination.Namespace,
-			NoCache:            true,
-			HasMultipleSources: true,
-			RefSources:         refSources,
-			Repo:               repoOverride,
-			ProjectName:        "applications",
-		})
+		repoOverride := r.createRepoOverride(sourceCopy, localPaths[i], i, app.Name)
+
+		request, err := r.manifestRequest(app, &sourceCopy, repoOverride)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare manifests generation for source %d: %w", i, err)
+		}
+		request.RefSources = refSources
+		response, err := r.generateManifest(ctx, request)
 		if err != nil {
 			return nil, fmt.Errorf("failed to generate manifests for source %d: %w", i, err)
 		}
 
-		allManifests = append(allManifests, response.Manifests...)
+		allManifests = append(allManifests, response.Manifests)
 	}
 
 	return allManifests, nil
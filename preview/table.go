@@ -0,0 +1,100 @@
+package preview
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/argoproj/gitops-engine/pkg/sync/hook"
+	"github.com/argoproj/gitops-engine/pkg/sync/syncwaves"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Table output format constants
+const (
+	outputFormatTable = "table"
+	outputFormatWide  = "wide"
+)
+
+// resourceRow is a resource listed in the table output, along with where it comes from
+type resourceRow struct {
+	appName     string
+	sourceIndex int
+	resource    *unstructured.Unstructured
+}
+
+// isTableOutput returns true if the output format prints resources as a table
+func isTableOutput(output string) bool {
+	return output == outputFormatTable || output == outputFormatWide
+}
+
+// resourceRows lists the resources of an Application selected by the matcher, in the given order
+func resourceRows(
+	appName string,
+	sources renderedSources,
+	matcher *resourceMatcher,
+	order ResourceOrder,
+) []resourceRow {
+	sourceIndexes := map[*unstructured.Unstructured]int{}
+	var resources []*unstructured.Unstructured
+	for sourceIndex, sourceResources := range sources {
+		for _, resource := range selectResources(sourceResources, matcher) {
+			sourceIndexes[resource] = sourceIndex
+			resources = append(resources, resource)
+		}
+	}
+	sortResources(resources, order)
+
+	rows := make([]resourceRow, 0, len(resources))
+	for _, resource := range resources {
+		rows = append(rows, resourceRow{appName: appName, sourceIndex: sourceIndexes[resource], resource: resource})
+	}
+	return rows
+}
+
+// newTableWriter returns a writer aligning tab separated columns the same way kubectl does
+func newTableWriter(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 6, 4, 3, ' ', 0)
+}
+
+// printResourceTable prints resources as a table. The wide format adds the sync wave,
+// the hook types and the index of the Application source of each resource.
+func printResourceTable(w io.Writer, rows []resourceRow, wide bool) error {
+	tw := newTableWriter(w)
+	header := "APP\tGROUP/VERSION\tKIND\tNAMESPACE\tNAME"
+	if wide {
+		header += "\tSYNC-WAVE\tHOOK\tSOURCE"
+	}
+	fmt.Fprintln(tw, header)
+
+	for _, row := range rows {
+		resource := row.resource
+		line := strings.Join([]string{
+			row.appName, resource.GetAPIVersion(), resource.GetKind(), resource.GetNamespace(), resource.GetName(),
+		}, "\t")
+		if wide {
+			line += "\t" + strings.Join([]string{
+				strconv.Itoa(syncwaves.Wave(resource)), hookTypes(resource), strconv.Itoa(row.sourceIndex),
+			}, "\t")
+		}
+		fmt.Fprintln(tw, line)
+	}
+	return tw.Flush()
+}
+
+// hookTypes returns the sorted, comma separated hook types of a resource, or an empty string if it is not a hook
+func hookTypes(resource *unstructured.Unstructured) string {
+	if !hook.IsHook(resource) {
+		return ""
+	}
+	types := hook.Types(resource)
+	names := make([]string, 0, len(types))
+	for _, hookType := range types {
+		names = append(names, string(hookType))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
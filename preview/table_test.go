@@ -0,0 +1,56 @@
+package preview
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestPrintResourceTable verifies the table output, grouped by kind across sources
+func TestPrintResourceTable(t *testing.T) {
+	sources := renderedSources{
+		mustParseManifests(t,
+			`{"apiVersion":"v1","kind":"Service","metadata":{"name":"web","namespace":"prod"}}`,
+			`{"apiVersion":"apps/v1","kind":"Deployment","metadata":{"name":"web","namespace":"prod"}}`,
+		),
+		mustParseManifests(t,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings"}}`,
+		),
+	}
+
+	var buf bytes.Buffer
+	all := mustCompileFilter(t, ResourceFilter{})
+	require.NoError(t, printResourceTable(&buf, resourceRows("guestbook", sources, all, OrderKind), false))
+	require.Equal(t,
+		"APP         GROUP/VERSION   KIND         NAMESPACE   NAME\n"+
+			"guestbook   v1              ConfigMap                settings\n"+
+			"guestbook   apps/v1         Deployment   prod        web\n"+
+			"guestbook   v1              Service      prod        web\n",
+		buf.String())
+}
+
+// TestPrintResourceTableWide verifies that the wide output adds the sync wave, hook types and source index
+func TestPrintResourceTableWide(t *testing.T) {
+	sources := renderedSources{
+		mustParseManifests(t,
+			`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"settings",`+
+				`"annotations":{"argocd.argoproj.io/sync-wave":"-1"}}}`,
+		),
+		mustParseManifests(t,
+			`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"migrate",`+
+				`"annotations":{"argocd.argoproj.io/hook":"PreSync,PostSync"}}}`,
+			`{"apiVersion":"batch/v1","kind":"Job","metadata":{"name":"seed",`+
+				`"annotations":{"helm.sh/hook":"post-install","helm.sh/hook-weight":"5"}}}`,
+		),
+	}
+
+	var buf bytes.Buffer
+	jobs := mustCompileFilter(t, ResourceFilter{Kind: "job"})
+	require.NoError(t, printResourceTable(&buf, resourceRows("guestbook", sources, jobs, OrderKind), true))
+	require.Equal(t,
+		"APP         GROUP/VERSION   KIND   NAMESPACE   NAME      SYNC-WAVE   HOOK               SOURCE\n"+
+			"guestbook   batch/v1        Job                migrate   0           PostSync,PreSync   1\n"+
+			"guestbook   batch/v1        Job                seed      5           PostSync           1\n",
+		buf.String())
+}
@@ -0,0 +1,190 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	argoappv1 "github.com/argoproj/argo-cd/v3/pkg/apis/application/v1alpha1"
+	"github.com/argoproj/gitops-engine/pkg/utils/kube"
+	errorsutil "github.com/argoproj/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/version"
+)
+
+// SchemaOptions selects the schemas the rendered resources are validated against
+type SchemaOptions struct {
+	// SchemaDir is a directory of OpenAPI documents of the Kubernetes version to validate against.
+	// Empty means the schemas of the Kubernetes version bundled with the binary.
+	SchemaDir string
+	// CRDFiles are manifest files of the CRDs custom resources are validated against,
+	// in addition to the CRDs rendered along with them
+	CRDFiles []string
+}
+
+// validationError is a schema violation of a rendered resource
+type validationError struct {
+	appName  string
+	resource *unstructured.Unstructured
+	message  string
+}
+
+// validationResult holds the schema violations of the rendered resources
+type validationResult struct {
+	errors []validationError
+	// validated and invalid count the resources validated, skipped those without a schema
+	validated, invalid, skipped int
+}
+
+// ValidateApplicationResources renders an Application manifest and validates the resources against their schemas,
+// returning false if any of them is invalid
+func ValidateApplicationResources(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	schemaOpts SchemaOptions,
+	filename string,
+	filter ResourceFilter,
+) bool {
+	return generateAndValidate(ctx, w, opts, schemaOpts, filename, loadApplicationsFile, AppFilter{}, filter)
+}
+
+// ValidateResources renders an ApplicationSet manifest and validates the resources against their schemas,
+// returning false if any of them is invalid
+func ValidateResources(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	schemaOpts SchemaOptions,
+	filename string,
+	appFilter AppFilter,
+	filter ResourceFilter,
+) bool {
+	return generateAndValidate(ctx, w, opts, schemaOpts, filename, expandApplicationSetFile, appFilter, filter)
+}
+
+// generateAndValidate renders the Applications of a manifest file, validates their resources and outputs
+// the schema violations by Application and resource
+func generateAndValidate(
+	ctx context.Context,
+	w io.Writer,
+	opts Options,
+	schemaOpts SchemaOptions,
+	filename string,
+	load applicationsLoader,
+	appFilter AppFilter,
+	filter ResourceFilter,
+) bool {
+	appsMatcher := appFilter.mustCompile()
+	matcher := filter.mustCompile()
+	registry, err := newSchemaRegistry(schemaOpts.SchemaDir)
+	errorsutil.CheckError(err)
+	if schemaOpts.SchemaDir == "" {
+		warnBundledKubeVersion(opts.Capabilities.KubeVersion)
+	}
+	for _, crdFile := range schemaOpts.CRDFiles {
+		crds, err := LoadCRDs(crdFile)
+		errorsutil.CheckError(err)
+		for _, crd := range crds {
+			errorsutil.CheckError(registry.addCRD(crd))
+		}
+	}
+
+	renderer, err := NewRenderer(opts)
+	errorsutil.CheckError(err)
+	defer renderer.Close()
+	apps, err := load(ctx, renderer, filename)
+	errorsutil.CheckError(err)
+	selected := appsMatcher.selectApplications(apps)
+	rendered, err := renderer.RenderApplications(ctx, selected)
+	errorsutil.CheckError(err)
+
+	// The CRDs of all the Applications are known to the cluster once synced
+	for _, resources := range rendered {
+		for _, resource := range resources {
+			if kube.IsCRD(resource) {
+				errorsutil.CheckError(registry.addCRD(resource))
+			}
+		}
+	}
+
+	result := validateRenderedResources(registry, selected, rendered, matcher)
+	errorsutil.CheckError(printValidationResult(w, result))
+	return len(result.errors) == 0
+}
+
+// warnBundledKubeVersion warns when the bundled schemas are not those of the Kubernetes version rendered for
+func warnBundledKubeVersion(kubeVersion string) {
+	if kubeVersion == "" {
+		return
+	}
+	rendered, err := version.ParseGeneric(kubeVersion)
+	if err != nil {
+		return
+	}
+	bundled := version.MustParseGeneric(bundledKubeVersion)
+	if rendered.Major() != bundled.Major() || rendered.Minor() != bundled.Minor() {
+		log.Warnf("Validating against the bundled schemas of Kubernetes %s, not %s: "+
+			"use the OpenAPI documents of that version instead", bundledKubeVersion, kubeVersion)
+	}
+}
+
+// validateRenderedResources validates the resources of each Application selected by the matcher.
+// The resources of kinds without a schema are skipped with a warning, unless their API group has schemas,
+// in which case the kind or version does not exist.
+func validateRenderedResources(
+	registry *schemaRegistry,
+	apps []argoappv1.Application,
+	rendered [][]*unstructured.Unstructured,
+	matcher *resourceMatcher,
+) validationResult {
+	var result validationResult
+	for i, resources := range rendered {
+		resources = selectResources(resources, matcher)
+		sortResources(resources, OrderName)
+		for _, resource := range resources {
+			violations, err := registry.validate(resource)
+			if errors.Is(err, errSchemaNotFound) {
+				if !registry.isKnownGroup(resource.GroupVersionKind().Group) {
+					key := kube.GetResourceKey(resource)
+					log.Warnf("Application %s: skipping %s, %v", apps[i].Name, key.String(), err)
+					result.skipped++
+					continue
+				}
+				violations = []string{err.Error()}
+			}
+			result.validated++
+			if len(violations) > 0 {
+				result.invalid++
+			}
+			for _, violation := range violations {
+				result.errors = append(result.errors,
+					validationError{appName: apps[i].Name, resource: resource, message: violation})
+			}
+		}
+	}
+	return result
+}
+
+// printValidationResult prints the schema violations as a table, followed by a summary
+func printValidationResult(w io.Writer, result validationResult) error {
+	if len(result.errors) > 0 {
+		tw := newTableWriter(w)
+		fmt.Fprintln(tw, "APP\tKIND\tNAMESPACE\tNAME\tERROR")
+		for _, e := range result.errors {
+			fmt.Fprintln(tw, strings.Join([]string{
+				e.appName, e.resource.GetKind(), e.resource.GetNamespace(), e.resource.GetName(), e.message,
+			}, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintln(w)
+	}
+	_, err := fmt.Fprintf(w, "%d resource(s) validated, %d invalid, %d skipped without a schema\n",
+		result.validated, result.invalid, result.skipped)
+	return err
+}